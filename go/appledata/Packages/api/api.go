@@ -0,0 +1,358 @@
+// Package api serves the content of a generated DB as a read-only JSON
+// HTTP API. The whole DB is loaded in memory when the server is created.
+package api
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/dbtools"
+	"appledata/Packages/resolve"
+	"appledata/Packages/version"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//go:embed openapi.yaml
+var OpenAPISpec []byte
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+type Processor struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+}
+
+type Device struct {
+	Codename  string             `json:"codename"`
+	Modelname string             `json:"modelname"`
+	Family    string             `json:"family"`
+	Cpu       *Processor         `json:"cpu"`
+	MinOS     *version.OSVersion `json:"min_os"`
+	MaxOS     *version.OSVersion `json:"max_os"`
+	// only set on /devices/{hardwareString}
+	OSVersions []version.OSVersion `json:"os_versions,omitempty"`
+}
+
+type Release struct {
+	Family  string            `json:"family"`
+	Version version.OSVersion `json:"version"`
+	Builds  []string          `json:"builds"`
+	// Darwin is the kernel version of the release, omitted when unknown
+	Darwin *version.OSVersion `json:"darwin,omitempty"`
+}
+
+type Build struct {
+	Build   string  `json:"build"`
+	Release Release `json:"release"`
+}
+
+// Page is the envelope of every list response.
+type Page struct {
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+	Items  interface{} `json:"items"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// Server is an http.Handler answering API requests from a dataset. It is
+// safe for concurrent use.
+type Server struct {
+	ds       *dataset.Dataset
+	revision string
+	devices  map[string]*dataset.Device
+	builds   map[string]*dataset.Release
+	resolver *resolve.Resolver
+}
+
+// New returns a server over ds. meta is the build metadata of the DB ds
+// was loaded from, newest first: every ETag derives from the latest run,
+// so that clients revalidate only when the DB was regenerated.
+func New(ds *dataset.Dataset, meta []dbtools.BuildMetadata) *Server {
+	s := &Server{ds: ds, revision: "none", devices: map[string]*dataset.Device{}, builds: map[string]*dataset.Release{}, resolver: resolve.New(ds)}
+	if len(meta) > 0 {
+		s.revision = fmt.Sprintf("%d-%d", meta[0].ID, meta[0].FinishedAt.UnixNano())
+	}
+	for _, d := range ds.Devices {
+		s.devices[d.Codename] = d
+	}
+	for _, r := range ds.Releases {
+		for _, b := range r.Builds {
+			s.builds[b] = r
+		}
+	}
+	return s
+}
+
+// Open loads the DB file at dbfile and returns a server over it.
+func Open(dbfile string) (*Server, error) {
+	ds, err := dataset.LoadFile(dbfile)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := dbtools.ReadMetadata(dbfile)
+	if err != nil {
+		return nil, err
+	}
+	return New(ds, meta), nil
+}
+
+func toProcessor(p *dataset.Processor) *Processor {
+	if p == nil {
+		return nil
+	}
+	return &Processor{Code: p.Code, Label: p.Label}
+}
+
+func toDevice(d *dataset.Device) Device {
+	return Device{
+		Codename:  d.Codename,
+		Modelname: d.Modelname,
+		Family:    string(version.HardwareFamily(d.Codename)),
+		Cpu:       toProcessor(d.Cpu),
+		MinOS:     d.MinOS(),
+		MaxOS:     d.MaxOS(),
+	}
+}
+
+func toRelease(r *dataset.Release) Release {
+	return Release{Family: r.Family, Version: r.Version, Builds: append([]string{}, r.Builds...), Darwin: r.Darwin}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "openapi.yaml":
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(OpenAPISpec)
+	case len(parts) == 1 && parts[0] == "devices":
+		s.listDevices(w, r)
+	case len(parts) == 2 && parts[0] == "devices":
+		s.getDevice(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "processors":
+		s.listProcessors(w, r)
+	case len(parts) == 3 && parts[0] == "os" && parts[2] == "versions":
+		s.listVersions(w, r, parts[1])
+	case len(parts) == 2 && parts[0] == "builds":
+		s.getBuild(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "resolve":
+		s.resolve(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "no such endpoint %s", r.URL.Path)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Error: fmt.Sprintf(format, args...)})
+}
+
+// etag identifies the response to r: the same request on the same DB
+// always yields the same body. Responses varying on the User-Agent header
+// include it.
+func (s *Server) etag(w http.ResponseWriter, r *http.Request) string {
+	key := s.revision + " " + r.URL.RequestURI()
+	if strings.Contains(w.Header().Get("Vary"), "User-Agent") {
+		key += " " + r.UserAgent()
+	}
+	sum := sha1.Sum([]byte(key))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, body interface{}) {
+	etag := s.etag(w, r)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if c := strings.TrimSpace(candidate); c == etag || c == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(body)
+}
+
+func intParam(r *http.Request, name string, def int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer, got %q", name, raw)
+	}
+	return n, nil
+}
+
+func versionParam(r *http.Request, name string) (*version.OSVersion, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := version.OSVersionFromString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a version like 17.4, got %q", name, raw)
+	}
+	return &v, nil
+}
+
+// paginate returns the page of n items selected by the limit and offset
+// query parameters, as [start, end) bounds.
+func paginate(r *http.Request, n int) (page Page, start int, end int, err error) {
+	limit, err := intParam(r, "limit", DefaultLimit)
+	if err != nil {
+		return page, 0, 0, err
+	}
+	if limit == 0 || limit > MaxLimit {
+		return page, 0, 0, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+	}
+	offset, err := intParam(r, "offset", 0)
+	if err != nil {
+		return page, 0, 0, err
+	}
+	// clamped before adding limit, which could overflow past a huge offset
+	start = offset
+	if start > n {
+		start = n
+	}
+	end = start + limit
+	if limit > n-start {
+		end = n
+	}
+	return Page{Total: n, Limit: limit, Offset: offset}, start, end, nil
+}
+
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	supports, err := versionParam(r, "supports")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	matches := s.ds.FilterDevices(dataset.DeviceFilter{Family: q.Get("family"), Cpu: q.Get("cpu"), Model: q.Get("q"), Supports: supports})
+	page, start, end, err := paginate(r, len(matches))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	items := []Device{}
+	for _, d := range matches[start:end] {
+		items = append(items, toDevice(d))
+	}
+	page.Items = items
+	s.writeJSON(w, r, page)
+}
+
+func (s *Server) getDevice(w http.ResponseWriter, r *http.Request, hardwareString string) {
+	d, ok := s.devices[hardwareString]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown device %s", hardwareString)
+		return
+	}
+	dev := toDevice(d)
+	dev.OSVersions = []version.OSVersion{}
+	for _, rel := range d.Releases {
+		dev.OSVersions = append(dev.OSVersions, rel.Version)
+	}
+	s.writeJSON(w, r, dev)
+}
+
+func (s *Server) listProcessors(w http.ResponseWriter, r *http.Request) {
+	page, start, end, err := paginate(r, len(s.ds.Processors))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	items := []Processor{}
+	for _, p := range s.ds.Processors[start:end] {
+		items = append(items, *toProcessor(p))
+	}
+	page.Items = items
+	s.writeJSON(w, r, page)
+}
+
+func (s *Server) listVersions(w http.ResponseWriter, r *http.Request, family string) {
+	q := r.URL.Query()
+	var releases []*dataset.Release
+	if hw := q.Get("device"); hw != "" {
+		d, ok := s.devices[hw]
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown device %s", hw)
+			return
+		}
+		releases = d.Releases
+	} else {
+		releases = s.ds.Releases
+	}
+	major, err := intParam(r, "major", -1)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	var matches []*dataset.Release
+	for _, rel := range releases {
+		if rel.Family != family || (major >= 0 && rel.Version.X != major) {
+			continue
+		}
+		matches = append(matches, rel)
+	}
+	page, start, end, err := paginate(r, len(matches))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	items := []Release{}
+	for _, rel := range matches[start:end] {
+		items = append(items, toRelease(rel))
+	}
+	page.Items = items
+	s.writeJSON(w, r, page)
+}
+
+func (s *Server) getBuild(w http.ResponseWriter, r *http.Request, build string) {
+	rel, ok := s.builds[build]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown build %s", build)
+		return
+	}
+	s.writeJSON(w, r, Build{Build: build, Release: toRelease(rel)})
+}
+
+// resolve resolves the ua and machine query parameters, or the
+// User-Agent of the request when both are missing.
+func (s *Server) resolve(w http.ResponseWriter, r *http.Request) {
+	ua, machine := r.URL.Query().Get("ua"), r.URL.Query().Get("machine")
+	if ua == "" && machine == "" {
+		ua = r.UserAgent()
+		w.Header().Set("Vary", "User-Agent")
+	}
+	res, err := s.resolver.Resolve(ua, machine)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	s.writeJSON(w, r, res)
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"appledata/Packages/dbtools"
+	"appledata/Packages/resolve"
+	"appledata/Packages/version"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+)
+
+func v(s string) version.OSVersion {
+	ver, _ := version.OSVersionFromString(s)
+	return ver
+}
+
+func testServer(t *testing.T) *Server {
+	dbfile := path.Join(t.TempDir(), dbtools.DB_NAME)
+	s, err := dbtools.NewSQLStore(dbfile, dbtools.Options{})
+	if err != nil {
+		t.Fatalf("NewSQLStore: %s", err.Error())
+	}
+	s.UpdateCPU("A16_Bionic", "A16 Bionic")
+	for ver, builds := range map[string][]string{"16.0": {"20A362"}, "17.0": {"21A329"}, "17.0.1": {"21A341", "21A340"}} {
+		iv := version.IOSVersion{Version: v(ver)}
+		for _, b := range builds {
+			bn, _ := version.BuildNumberFromString(b)
+			iv.Builds = append(iv.Builds, bn)
+		}
+		s.AddIOSVersion(iv)
+	}
+	s.AddDevice("iPhone 15", "iPhone15,4", "Apple A16 Bionic", v("17.0"), v("17.0.1"))
+	s.AddDevice("iPhone 14", "iPhone14,7", "Apple A15 Bionic", v("16.0"), v("17.0"))
+	s.AddDevice("iPad (10th generation)", "iPad13,18", "Apple A14 Bionic", v("16.0"), v("17.0.1"))
+	if err := s.Flush(dbtools.BuildMetadata{Mode: "generate"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	srv, err := Open(dbfile)
+	if err != nil {
+		t.Fatalf("Open: %s", err.Error())
+	}
+	return srv
+}
+
+func get(t *testing.T, srv *Server, url string, etag string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if body != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), body); err != nil {
+			t.Fatalf("%s: %s", url, err.Error())
+		}
+	}
+	return rec
+}
+
+func TestDevices(t *testing.T) {
+	srv := testServer(t)
+
+	var page struct {
+		Page
+		Items []Device `json:"items"`
+	}
+	if rec := get(t, srv, "/devices?limit=2", "", &page); rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	// sorted by hardware identifier: iPhones first
+	if page.Total != 3 || len(page.Items) != 2 || page.Items[0].Codename != "iPhone14,7" || page.Items[1].Cpu.Code != "A16_Bionic" {
+		t.Fatalf("Unexpected first page: %+v", page)
+	}
+	get(t, srv, "/devices?limit=2&offset=2", "", &page)
+	if len(page.Items) != 1 || page.Items[0].Codename != "iPad13,18" || page.Items[0].Family != "iPad" {
+		t.Fatalf("Unexpected second page: %+v", page)
+	}
+	if rec := get(t, srv, "/devices?offset=9223372036854775807", "", &page); rec.Code != http.StatusOK || page.Total != 3 || len(page.Items) != 0 {
+		t.Fatalf("A huge offset should return an empty page: %d %s", rec.Code, rec.Body.String())
+	}
+	get(t, srv, "/devices?family=iphone&supports=17.0.1", "", &page)
+	if page.Total != 1 || page.Items[0].Codename != "iPhone15,4" || page.Items[0].MinOS.String() != "17.0.0" {
+		t.Fatalf("Unexpected filtered devices: %+v", page)
+	}
+	for _, url := range []string{"/devices?limit=0", "/devices?offset=-1", "/devices?supports=latest"} {
+		if rec := get(t, srv, url, "", nil); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400, got %d", url, rec.Code)
+		}
+	}
+
+	var dev Device
+	get(t, srv, "/devices/iPhone14,7", "", &dev)
+	if dev.Cpu != nil || len(dev.OSVersions) != 2 || dev.OSVersions[1].String() != "17.0.0" {
+		t.Fatalf("Unexpected device: %+v", dev)
+	}
+	if rec := get(t, srv, "/devices/iPhone99,1", "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestVersionsAndBuilds(t *testing.T) {
+	srv := testServer(t)
+
+	var page struct {
+		Page
+		Items []Release `json:"items"`
+	}
+	get(t, srv, "/os/ios/versions?device=iPhone15,4", "", &page)
+	if page.Total != 2 || page.Items[1].Version.String() != "17.0.1" || len(page.Items[1].Builds) != 2 {
+		t.Fatalf("Unexpected versions: %+v", page)
+	}
+	get(t, srv, "/os/ios/versions?major=16", "", &page)
+	if page.Total != 1 || page.Items[0].Version.String() != "16.0.0" {
+		t.Fatalf("Unexpected versions: %+v", page)
+	}
+
+	var build Build
+	get(t, srv, "/builds/21A341", "", &build)
+	if build.Release.Version.String() != "17.0.1" {
+		t.Fatalf("Unexpected build: %+v", build)
+	}
+	if rec := get(t, srv, "/builds/00A000", "", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestETag(t *testing.T) {
+	srv := testServer(t)
+
+	rec := get(t, srv, "/processors", "", nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected an ETag, got status %d", rec.Code)
+	}
+	if rec := get(t, srv, "/processors", etag, nil); rec.Code != http.StatusNotModified {
+		t.Fatalf("Expected status 304, got %d", rec.Code)
+	}
+	if other := get(t, srv, "/processors?limit=1", "", nil).Header().Get("ETag"); other == etag {
+		t.Fatalf("Different requests should not share an ETag")
+	}
+	// a regenerated db invalidates every ETag
+	if regenerated := testServer(t); get(t, regenerated, "/processors", etag, nil).Code != http.StatusOK {
+		t.Fatalf("ETag should change with the build metadata")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	srv := testServer(t)
+
+	var res resolve.Result
+	get(t, srv, "/resolve?machine=iPhone15,4&ua="+url.QueryEscape("Mozilla/5.0 (iPhone; CPU iPhone OS 16_0 like Mac OS X)"), "", &res)
+	if res.ModelName != "iPhone 15" || res.OSVersion != "16.0.0" || res.OSSupported == nil || *res.OSSupported {
+		t.Fatalf("Unexpected resolution: %+v", res)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/resolve", nil)
+	req.Header.Set("User-Agent", "MyApp/1.0 (iPhone14,7; iOS 17.0)")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Vary") != "User-Agent" || !strings.Contains(rec.Body.String(), `"os_supported": true`) {
+		t.Fatalf("Unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := get(t, srv, "/resolve?machine=iPhone", "", nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package codegen
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/version"
+	"appledata/Packages/wikipedia"
+	"sort"
+	"strings"
+)
+
+// Catalog is the data rendered by the code generators: one entry per
+// hardware string, sorted, plus processors and OS releases.
+type Catalog struct {
+	Devices    []CatalogDevice
+	Processors []CatalogProcessor
+	Releases   []CatalogRelease
+}
+
+type CatalogDevice struct {
+	HardwareString string
+	ModelName      string
+	Cpu            string // processor label, e.g. "A16 Bionic"
+	MinOS          version.OSVersion
+	MaxOS          version.OSVersion
+}
+
+type CatalogProcessor struct {
+	Code  string
+	Label string
+}
+
+type CatalogRelease struct {
+	Version version.OSVersion
+	Builds  []string
+}
+
+func (c *Catalog) sort() {
+	sort.SliceStable(c.Devices, func(i, j int) bool { return c.Devices[i].HardwareString < c.Devices[j].HardwareString })
+	sort.SliceStable(c.Processors, func(i, j int) bool { return c.Processors[i].Code < c.Processors[j].Code })
+	sort.SliceStable(c.Releases, func(i, j int) bool { return c.Releases[i].Version.Lt(c.Releases[j].Version) })
+	for _, r := range c.Releases {
+		sort.Strings(r.Builds)
+	}
+}
+
+// CatalogFromScrape builds a catalog straight from the parsed wiki pages.
+// Device OS ranges are the ones stated by the pages, which may start
+// before the oldest release the generator parses.
+func CatalogFromScrape(devices []wikipedia.Device, cpus []wikipedia.Cpu, versions []version.IOSVersion) Catalog {
+	var c Catalog
+	seen := map[string]bool{}
+	for _, d := range devices {
+		for _, hw := range d.Codenames {
+			if seen[hw] {
+				continue
+			}
+			seen[hw] = true
+			c.Devices = append(c.Devices, CatalogDevice{
+				HardwareString: hw,
+				ModelName:      d.Modelname,
+				Cpu:            strings.Replace(d.Cpu, "Apple ", "", 1),
+				MinOS:          d.MinOS,
+				MaxOS:          d.MaxOS,
+			})
+		}
+	}
+	for _, cpu := range cpus {
+		c.Processors = append(c.Processors, CatalogProcessor{Code: cpu.Code, Label: cpu.Label})
+	}
+	releases := map[version.OSVersion]int{}
+	for _, v := range versions {
+		idx, exists := releases[v.Version]
+		if !exists {
+			idx = len(c.Releases)
+			releases[v.Version] = idx
+			c.Releases = append(c.Releases, CatalogRelease{Version: v.Version})
+		}
+		for _, b := range v.Builds {
+			c.Releases[idx].Builds = append(c.Releases[idx].Builds, b.String())
+		}
+	}
+	c.sort()
+	return c
+}
+
+// CatalogFromDataset builds a catalog from the content of a generated DB.
+// Device OS ranges are the oldest and latest releases linked to each
+// device.
+func CatalogFromDataset(ds *dataset.Dataset) Catalog {
+	var c Catalog
+	for _, d := range ds.Devices {
+		dev := CatalogDevice{HardwareString: d.Codename, ModelName: d.Modelname}
+		if d.Cpu != nil {
+			dev.Cpu = d.Cpu.Label
+		}
+		if minos := d.MinOS(); minos != nil {
+			dev.MinOS = *minos
+		}
+		if maxos := d.MaxOS(); maxos != nil {
+			dev.MaxOS = *maxos
+		}
+		c.Devices = append(c.Devices, dev)
+	}
+	for _, p := range ds.Processors {
+		c.Processors = append(c.Processors, CatalogProcessor{Code: p.Code, Label: p.Label})
+	}
+	for _, r := range ds.Releases {
+		c.Releases = append(c.Releases, CatalogRelease{Version: r.Version, Builds: append([]string{}, r.Builds...)})
+	}
+	c.sort()
+	return c
+}
@@ -0,0 +1,99 @@
+package codegen
+
+import (
+	"appledata/Packages/version"
+	"appledata/Packages/wikipedia"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func testCatalog() Catalog {
+	v17, _ := version.OSVersionFromString("17.0")
+	v18, _ := version.OSVersionFromString("18.0")
+	b17, _ := version.BuildNumberFromString("21A329")
+	b18, _ := version.BuildNumberFromString("22A3354")
+	devices := []wikipedia.Device{
+		{Modelname: "iPhone 15", Codenames: []string{"iPhone15,5", "iPhone15,4"}, Cpu: "Apple A16 Bionic", MinOS: v17, MaxOS: v18},
+		{Modelname: `Quote "test"`, Codenames: []string{"iPhone1,1"}, Cpu: "Samsung S5L8900"},
+	}
+	cpus := []wikipedia.Cpu{{Code: "A16_Bionic", Label: "A16 Bionic"}}
+	versions := []version.IOSVersion{
+		{Version: v18, Builds: []version.BuildNumber{b18}},
+		{Version: v17, Builds: []version.BuildNumber{b17}},
+	}
+	return CatalogFromScrape(devices, cpus, versions)
+}
+
+func TestCatalogFromScrape(t *testing.T) {
+	c := testCatalog()
+	if len(c.Devices) != 3 || c.Devices[0].HardwareString != "iPhone1,1" || c.Devices[1].HardwareString != "iPhone15,4" {
+		t.Fatalf("Devices should be sorted by hardware string: %+v", c.Devices)
+	}
+	if c.Devices[1].Cpu != "A16 Bionic" {
+		t.Fatalf("Expected cpu label without vendor prefix, got %q", c.Devices[1].Cpu)
+	}
+	if len(c.Releases) != 2 || c.Releases[0].Version.X != 17 {
+		t.Fatalf("Releases should be sorted by version: %+v", c.Releases)
+	}
+}
+
+func typeCheck(t *testing.T, filename string, src []byte) *types.Package {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		t.Fatalf("Generated code does not parse: %s", err.Error())
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("example.com/appledevices", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatalf("Generated code does not type-check: %s\n%s", err.Error(), string(src))
+	}
+	return pkg
+}
+
+func TestGoPackage(t *testing.T) {
+	src, err := GoPackage("appledevices", testCatalog())
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pkg := typeCheck(t, "appledevices.go", src)
+	for _, name := range []string{"LookupDevice", "ModelName", "CPU", "MaxOS", "LookupBuild", "Devices", "Processors", "Releases"} {
+		if pkg.Scope().Lookup(name) == nil {
+			t.Fatalf("Generated package lacks %s", name)
+		}
+	}
+	if !strings.Contains(string(src), `{"iPhone15,4", "iPhone 15", "A16 Bionic", Version{17, 0, 0}, Version{18, 0, 0}},`) {
+		t.Fatalf("Unexpected generated code:\n%s", string(src))
+	}
+}
+
+func TestSwiftAndKotlin(t *testing.T) {
+	c := testCatalog()
+	swift, err := Swift(c, "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.Contains(string(swift), `public static let iPhone15_4 = AppleDevice(hardwareString: "iPhone15,4", modelName: "iPhone 15", cpu: "A16 Bionic", minOS: AppleOSVersion(17, 0, 0), maxOS: AppleOSVersion(18, 0, 0))`) {
+		t.Fatalf("Unexpected Swift output:\n%s", string(swift))
+	}
+	if !strings.Contains(string(swift), `modelName: "Quote \"test\""`) {
+		t.Fatalf("Swift strings are not escaped:\n%s", string(swift))
+	}
+	kotlin, err := Kotlin("com.example.devices", c, "")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.HasPrefix(string(kotlin), "// Code generated by appledata; DO NOT EDIT.\n\npackage com.example.devices\n") ||
+		!strings.Contains(string(kotlin), `AppleDevice("iPhone15,4", "iPhone 15", "A16 Bionic", AppleOSVersion(17, 0, 0), AppleOSVersion(18, 0, 0)),`) {
+		t.Fatalf("Unexpected Kotlin output:\n%s", string(kotlin))
+	}
+	custom, err := Kotlin("pkg", c, `{{range .Catalog.Devices}}{{.HardwareString}} {{end}}`)
+	if err != nil || string(custom) != "iPhone1,1 iPhone15,4 iPhone15,5 " {
+		t.Fatalf("Custom template not honoured: %q %v", string(custom), err)
+	}
+}
@@ -0,0 +1,65 @@
+package codegen
+
+import (
+	"fmt"
+	"go/format"
+	"os"
+	"path"
+	"sort"
+)
+
+type goBuild struct {
+	Build   string
+	Release int
+}
+
+// GoPackage renders c as the source of a self-contained Go package named
+// pkg, which depends on the standard library only.
+func GoPackage(pkg string, c Catalog) ([]byte, error) {
+	var builds []goBuild
+	seen := map[string]bool{}
+	for i, r := range c.Releases {
+		for _, b := range r.Builds {
+			if !seen[b] {
+				seen[b] = true
+				builds = append(builds, goBuild{Build: b, Release: i})
+			}
+		}
+	}
+	sort.Slice(builds, func(i, j int) bool { return builds[i].Build < builds[j].Build })
+
+	out, err := render("go", "", templateData{Package: pkg, Catalog: c, Builds: builds})
+	if err != nil {
+		return nil, err
+	}
+	src, err := format.Source(out)
+	if err != nil {
+		return nil, fmt.Errorf("generated code is not valid Go: %w", err)
+	}
+	return src, nil
+}
+
+// GoModule renders a go.mod file for a generated package, so that it can
+// be published as a module of its own.
+func GoModule(module string) []byte {
+	return []byte(fmt.Sprintf("module %s\n\ngo 1.18\n", module))
+}
+
+// WriteGoPackage writes the package rendered from c to <dir>/<pkg>.go,
+// along with a go.mod declaring module when module is not empty.
+func WriteGoPackage(dir string, pkg string, module string, c Catalog) error {
+	src, err := GoPackage(pkg, c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(dir, pkg+".go"), src, 0644); err != nil {
+		return err
+	}
+	if module == "" {
+		return nil
+	}
+	return os.WriteFile(path.Join(dir, "go.mod"), GoModule(module), 0644)
+}
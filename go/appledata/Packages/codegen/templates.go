@@ -0,0 +1,98 @@
+package codegen
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// Languages lists the targets with a built-in template.
+var Languages = []string{"go", "swift", "kotlin"}
+
+// templateData is what every code generation template is executed with.
+type templateData struct {
+	Package string // Go package or Kotlin package, empty for Swift
+	Catalog Catalog
+	Builds  []goBuild // Go only
+}
+
+var nonIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// identifier turns a hardware string into a valid Swift/Kotlin/Go
+// identifier, e.g. "iPhone15,4" -> "iPhone15_4".
+func identifier(s string) string {
+	id := nonIdentifierChars.ReplaceAllString(s, "_")
+	if id == "" || (id[0] >= '0' && id[0] <= '9') {
+		id = "_" + id
+	}
+	return id
+}
+
+var swiftEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+var kotlinEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+var templateFuncs = template.FuncMap{
+	"identifier":   identifier,
+	"goString":     strconv.Quote,
+	"swiftString":  func(s string) string { return `"` + swiftEscaper.Replace(s) + `"` },
+	"kotlinString": func(s string) string { return `"` + kotlinEscaper.Replace(s) + `"` },
+}
+
+// Template returns the built-in template for lang, one of Languages.
+func Template(lang string) (string, error) {
+	content, err := templateFS.ReadFile("templates/" + lang + ".tmpl")
+	if err != nil {
+		return "", fmt.Errorf("no built-in template for %q", lang)
+	}
+	return string(content), nil
+}
+
+// render executes text, or the built-in template for lang when text is
+// empty, against data.
+func render(lang string, text string, data templateData) ([]byte, error) {
+	if text == "" {
+		var err error
+		if text, err = Template(lang); err != nil {
+			return nil, err
+		}
+	}
+	tmpl, err := template.New(lang).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Swift renders c as a Swift source file, using the built-in template
+// unless tmpl is not empty.
+func Swift(c Catalog, tmpl string) ([]byte, error) {
+	return render("swift", tmpl, templateData{Catalog: c})
+}
+
+// Kotlin renders c as a Kotlin source file in package pkg, using the
+// built-in template unless tmpl is not empty.
+func Kotlin(pkg string, c Catalog, tmpl string) ([]byte, error) {
+	return render("kotlin", tmpl, templateData{Package: pkg, Catalog: c})
+}
+
+// ReadTemplate returns the content of the template file at filename, or
+// an empty string (meaning "built-in") when filename is empty.
+func ReadTemplate(filename string) (string, error) {
+	if filename == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(filename)
+	return string(content), err
+}
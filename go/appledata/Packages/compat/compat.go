@@ -0,0 +1,211 @@
+// Package compat answers compatibility questions over a generated DB, such
+// as "which devices can run 17.2 but not 18.0" or "what is the oldest
+// device on 16.x", from OS version set expressions.
+package compat
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/output"
+	"appledata/Packages/version"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	FormatTable = output.FormatTable
+	FormatJSON  = output.FormatJSON
+	FormatCSV   = output.FormatCSV
+)
+
+var Formats = output.Formats
+
+const (
+	StatusSupported = "supported"
+	StatusDropped   = "dropped"
+)
+
+// Query selects the devices running a release of Family in Supports and
+// none in Excludes. An empty Excludes excludes nothing.
+type Query struct {
+	Family   string
+	Supports version.OSVersionSet
+	Excludes version.OSVersionSet
+	// DeviceFamily restricts the devices to a single family, e.g. iPad,
+	// compared case-insensitively, all devices when empty.
+	DeviceFamily version.DeviceFamily
+}
+
+// ParseQuery builds a Query from version set expressions, as parsed by
+// version.ParseOSVersionSet; an empty excludes excludes nothing.
+func ParseQuery(family string, supports string, excludes string) (Query, error) {
+	q := Query{Family: family}
+	var err error
+	if q.Supports, err = version.ParseOSVersionSet(supports); err != nil {
+		return q, err
+	}
+	if excludes != "" {
+		if q.Excludes, err = version.ParseOSVersionSet(excludes); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// Device is a device along with the span of releases of the queried family
+// it runs.
+type Device struct {
+	Status         string            `json:"status"`
+	HardwareString string            `json:"hardware_string"`
+	ModelName      string            `json:"model_name"`
+	DeviceFamily   string            `json:"device_family"`
+	Cpu            string            `json:"cpu,omitempty"`
+	MinOS          version.OSVersion `json:"min_os"`
+	MaxOS          version.OSVersion `json:"max_os"`
+	// Matching lists the releases of Query.Supports the device runs, none
+	// for dropped devices.
+	Matching []version.OSVersion `json:"matching"`
+}
+
+// Report is the answer to a Query. Supported devices are sorted oldest
+// first: by MinOS, then by hardware identifier, so that the first one is
+// the oldest device matching the query. Dropped lists, in the same order,
+// the devices that ran an earlier release of the family but none in
+// Query.Supports.
+type Report struct {
+	Family   string `json:"family"`
+	Supports string `json:"supports"`
+	Excludes string `json:"excludes,omitempty"`
+	// Releases lists the releases of the DB in Query.Supports: a report
+	// without any is most likely a typo in the query.
+	Releases  []version.OSVersion `json:"releases"`
+	Supported []Device            `json:"supported"`
+	Dropped   []Device            `json:"dropped"`
+}
+
+// Run answers q from ds.
+func Run(ds *dataset.Dataset, q Query) Report {
+	report := Report{Family: q.Family, Supports: q.Supports.String(), Releases: []version.OSVersion{}, Supported: []Device{}, Dropped: []Device{}}
+	if !q.Excludes.IsEmpty() {
+		report.Excludes = q.Excludes.String()
+	}
+	var first *version.OSVersion
+	for _, rel := range ds.Releases {
+		if rel.Family == q.Family && q.Supports.Contains(rel.Version) {
+			report.Releases = append(report.Releases, rel.Version)
+			if first == nil {
+				first = &rel.Version
+			}
+		}
+	}
+	filter := dataset.DeviceFilter{Family: string(q.DeviceFamily)}
+	for _, d := range ds.Devices {
+		if !filter.Matches(d) {
+			continue
+		}
+		dev, runs := newDevice(d, q.Family)
+		if runs == 0 {
+			continue
+		}
+		excluded := false
+		for _, rel := range d.Releases {
+			if rel.Family != q.Family {
+				continue
+			}
+			if q.Supports.Contains(rel.Version) {
+				dev.Matching = append(dev.Matching, rel.Version)
+			}
+			excluded = excluded || q.Excludes.Contains(rel.Version)
+		}
+		switch {
+		case len(dev.Matching) > 0:
+			if !excluded {
+				dev.Status = StatusSupported
+				report.Supported = append(report.Supported, dev)
+			}
+		case first != nil && dev.MinOS.Lt(*first):
+			dev.Status = StatusDropped
+			report.Dropped = append(report.Dropped, dev)
+		}
+	}
+	sortDevices(report.Supported)
+	sortDevices(report.Dropped)
+	return report
+}
+
+// newDevice returns d along with the span of its releases of family, and
+// the number of these releases.
+func newDevice(d *dataset.Device, family string) (Device, int) {
+	dev := Device{HardwareString: d.Codename, ModelName: d.Modelname, DeviceFamily: string(version.HardwareFamily(d.Codename)), Matching: []version.OSVersion{}}
+	if d.Cpu != nil {
+		dev.Cpu = d.Cpu.Label
+	}
+	runs := 0
+	for _, rel := range d.Releases {
+		if rel.Family != family {
+			continue
+		}
+		if runs == 0 {
+			dev.MinOS = rel.Version
+		}
+		dev.MaxOS = rel.Version
+		runs++
+	}
+	return dev, runs
+}
+
+func sortDevices(devices []Device) {
+	sort.SliceStable(devices, func(i, j int) bool {
+		if !devices[i].MinOS.Eq(devices[j].MinOS) {
+			return devices[i].MinOS.Lt(devices[j].MinOS)
+		}
+		a, errA := version.HardwareIdentifierFromString(devices[i].HardwareString)
+		b, errB := version.HardwareIdentifierFromString(devices[j].HardwareString)
+		if errA != nil || errB != nil {
+			return devices[i].HardwareString < devices[j].HardwareString
+		}
+		return a.Lt(b)
+	})
+}
+
+// Devices returns the supported devices followed by the dropped ones.
+func (r Report) Devices() []Device {
+	return append(append([]Device{}, r.Supported...), r.Dropped...)
+}
+
+// Write writes r to w in format, one of Formats.
+func Write(w io.Writer, r Report, format string) error {
+	return output.Writers{
+		FormatTable: func(w io.Writer) error { return WriteTable(w, r) },
+		FormatJSON:  func(w io.Writer) error { return WriteJSON(w, r) },
+		FormatCSV:   func(w io.Writer) error { return WriteCSV(w, r) },
+	}.Write(w, format)
+}
+
+// WriteTable writes the devices of r as aligned columns, after a summary
+// line.
+func WriteTable(w io.Writer, r Report) error {
+	query := r.Family + " " + r.Supports
+	if r.Excludes != "" {
+		query += " excluding " + r.Excludes
+	}
+	fmt.Fprintf(w, "%s: %d releases, %d supported devices, %d dropped\n", query, len(r.Releases), len(r.Supported), len(r.Dropped))
+	var rows [][]string
+	for _, d := range r.Devices() {
+		rows = append(rows, []string{d.Status, d.HardwareString, d.ModelName, d.Cpu, d.MinOS.String(), d.MaxOS.String()})
+	}
+	return output.Table(w, []string{"STATUS", "HARDWARE", "MODEL", "CPU", "MIN OS", "MAX OS"}, rows)
+}
+
+func WriteJSON(w io.Writer, r Report) error {
+	return output.JSON(w, r)
+}
+
+// WriteCSV writes one row per device, with a header row.
+func WriteCSV(w io.Writer, r Report) error {
+	var rows [][]string
+	for _, d := range r.Devices() {
+		rows = append(rows, []string{d.Status, d.HardwareString, d.ModelName, d.DeviceFamily, d.Cpu, d.MinOS.String(), d.MaxOS.String()})
+	}
+	return output.CSV(w, []string{"status", "hardware_string", "model_name", "device_family", "cpu", "min_os", "max_os"}, rows)
+}
@@ -0,0 +1,209 @@
+package compat
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/dbtools"
+	"appledata/Packages/version"
+	"bytes"
+	"encoding/json"
+	"math"
+	"path"
+	"strings"
+	"testing"
+)
+
+func v(s string) version.OSVersion {
+	ver, _ := version.OSVersionFromString(s)
+	return ver
+}
+
+func testDataset(t *testing.T) *dataset.Dataset {
+	dbfile := path.Join(t.TempDir(), dbtools.DB_NAME)
+	s, err := dbtools.NewSQLStore(dbfile, dbtools.Options{})
+	if err != nil {
+		t.Fatalf("NewSQLStore: %s", err.Error())
+	}
+	s.UpdateCPU("A16_Bionic", "A16 Bionic")
+	for ver, build := range map[string]string{"15.8": "19H370", "16.0": "20A362", "16.7": "20H19", "17.0": "21A329", "17.2": "21C62", "18.0": "22A3354"} {
+		bn, _ := version.BuildNumberFromString(build)
+		s.AddIOSVersion(version.IOSVersion{Version: v(ver), Builds: []version.BuildNumber{bn}})
+	}
+	s.AddDevice("iPhone 15", "iPhone15,4", "Apple A16 Bionic", v("17.0"), v("18.0"))
+	s.AddDevice("iPhone X", "iPhone10,3", "Apple A11 Bionic", v("15.8"), v("16.7"))
+	s.AddDevice("iPhone XS", "iPhone11,2", "Apple A12 Bionic", v("15.8"), v("18.0"))
+	s.AddDevice("iPad (6th generation)", "iPad7,5", "Apple A10 Fusion", v("15.8"), v("17.2"))
+	s.AddDevice("iPhone 7", "iPhone9,1", "Apple A10 Fusion", v("15.8"), v("15.8"))
+	if err := s.Flush(dbtools.BuildMetadata{Mode: "generate"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	ds, err := dataset.LoadFile(dbfile)
+	if err != nil {
+		t.Fatalf("LoadFile: %s", err.Error())
+	}
+	return ds
+}
+
+func hardwareStrings(devices []Device) string {
+	var out []string
+	for _, d := range devices {
+		out = append(out, d.HardwareString)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestRun(t *testing.T) {
+	ds := testDataset(t)
+	for _, tc := range []struct {
+		supports, excludes string
+		family             version.DeviceFamily
+		supported, dropped string
+	}{
+		{"17.2", "", "", "iPhone11,2 iPad7,5 iPhone15,4", "iPhone9,1 iPhone10,3"},
+		{"17.2", "18.0", "", "iPad7,5", "iPhone9,1 iPhone10,3"},
+		{">=16 <17", "", "", "iPhone10,3 iPhone11,2 iPad7,5", "iPhone9,1"},
+		{">=16 <17", "", version.FamilyIPhone, "iPhone10,3 iPhone11,2", "iPhone9,1"},
+		{">=16 <17", "", "iphone", "iPhone10,3 iPhone11,2", "iPhone9,1"},
+		{"19.0", "", "", "", ""},
+	} {
+		q, err := ParseQuery("ios", tc.supports, tc.excludes)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		q.DeviceFamily = tc.family
+		r := Run(ds, q)
+		if hardwareStrings(r.Supported) != tc.supported || hardwareStrings(r.Dropped) != tc.dropped {
+			t.Fatalf("%s excluding %q: expected supported %q and dropped %q, got %q and %q", tc.supports, tc.excludes, tc.supported, tc.dropped, hardwareStrings(r.Supported), hardwareStrings(r.Dropped))
+		}
+	}
+	// oldest device on 16.x
+	q, _ := ParseQuery("ios", ">=16 <17", "")
+	oldest := Run(ds, q).Supported[0]
+	if oldest.HardwareString != "iPhone10,3" || oldest.MinOS.String() != "15.8.0" || len(oldest.Matching) != 2 {
+		t.Fatalf("Unexpected oldest device: %+v", oldest)
+	}
+	if _, err := ParseQuery("ios", ">=16.x", ""); err == nil {
+		t.Fatalf("A bad expression should not parse")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	ds := testDataset(t)
+	q, _ := ParseQuery("ios", "17.2", "18.0")
+	r := Run(ds, q)
+
+	var buf bytes.Buffer
+	must(t, Write(&buf, r, FormatCSV))
+	expected := "status,hardware_string,model_name,device_family,cpu,min_os,max_os\n" +
+		"supported,\"iPad7,5\",iPad (6th generation),iPad,,15.8.0,17.2.0\n" +
+		"dropped,\"iPhone9,1\",iPhone 7,iPhone,,15.8.0,15.8.0\n" +
+		"dropped,\"iPhone10,3\",iPhone X,iPhone,,15.8.0,16.7.0\n"
+	if buf.String() != expected {
+		t.Fatalf("Unexpected CSV, expected\n%s\ngot\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	must(t, Write(&buf, r, FormatJSON))
+	var back Report
+	if err := json.Unmarshal(buf.Bytes(), &back); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if back.Supports != "[17.2.0,17.2.0]" || back.Excludes != "[18.0.0,18.0.0]" || len(back.Supported) != 1 || len(back.Dropped) != 2 || !back.Supported[0].MaxOS.Eq(v("17.2")) {
+		t.Fatalf("Unexpected JSON report: %s", buf.String())
+	}
+
+	buf.Reset()
+	must(t, Write(&buf, r, FormatTable))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "ios [17.2.0,17.2.0] excluding [18.0.0,18.0.0]: 1 releases, 1 supported devices, 2 dropped") || !strings.HasPrefix(lines[2], "supported  iPad7,5") {
+		t.Fatalf("Unexpected table:\n%s", buf.String())
+	}
+
+	if err := Write(&buf, r, "xml"); err == nil {
+		t.Fatalf("Unknown formats should be rejected")
+	}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func TestReadWeights(t *testing.T) {
+	weights, err := ReadWeights(strings.NewReader("device,users\n\"iPhone10,3\",10\niPhone9,1,5\niPhone X, 2.5%\niPhone9,1,5\n"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(weights) != 3 || weights["iPhone10,3"] != 10 || weights["iPhone9,1"] != 10 || weights["iPhone X"] != 2.5 {
+		t.Fatalf("Unexpected weights: %v", weights)
+	}
+	for _, bad := range []string{"", "device,users\n", "iPhone X,1\niPhone 7,lots\n", "iPhone X,-1\n", "a,b,c,d\n"} {
+		if _, err := ReadWeights(strings.NewReader(bad)); err == nil {
+			t.Fatalf("%q should not be read", bad)
+		}
+	}
+}
+
+func TestAssess(t *testing.T) {
+	ds := testDataset(t)
+	impact := Assess(ds, "ios", v("17.0"), "", nil)
+	if hardwareStrings(impactDevices(impact)) != "iPhone9,1 iPhone10,3" || impact.Kept != 3 || impact.ExcludedShare != nil || impact.Excluded[0].Share != nil {
+		t.Fatalf("Unexpected impact: %+v", impact)
+	}
+
+	// matched weights add up to 100
+	weights := Weights{"iPhone9,1": 10, "iPhone X": 30, "iPhone15,4": 35, "iPhone XS": 10, "iPad (6th generation)": 15, "iPod touch": 5}
+	impact = Assess(ds, "ios", v("17.0"), "", weights)
+	if impact.ExcludedShare == nil || *impact.ExcludedShare != 40 || *impact.Excluded[0].Share != 10 || *impact.Excluded[1].Share != 30 {
+		t.Fatalf("Unexpected weighted impact: %+v", impact)
+	}
+	if len(impact.Unmatched) != 1 || impact.Unmatched[0] != "iPod touch" {
+		t.Fatalf("Expected iPod touch to be unmatched, got %v", impact.Unmatched)
+	}
+
+	// a target newer than every release excludes every device
+	impact = Assess(ds, "ios", v("19.0"), "", weights)
+	if len(impact.Excluded) != 5 || impact.Kept != 0 || *impact.ExcludedShare != 100 {
+		t.Fatalf("Unexpected future target impact: %+v", impact)
+	}
+
+	// only the weights of the devices of the family are counted
+	impact = Assess(ds, "ios", v("17.0"), version.FamilyIPhone, weights)
+	if hardwareStrings(impactDevices(impact)) != "iPhone9,1 iPhone10,3" || impact.Kept != 2 || math.Abs(*impact.ExcludedShare-40.0/85*100) > 1e-9 {
+		t.Fatalf("Unexpected iPhone impact: %+v", impact)
+	}
+	if lower := Assess(ds, "ios", v("17.0"), "iphone", weights); lower.Kept != 2 || *lower.ExcludedShare != *impact.ExcludedShare {
+		t.Fatalf("The device family should be case insensitive: %+v", lower)
+	}
+	impact = Assess(ds, "ios", v("18.0"), version.FamilyIPad, weights)
+	if hardwareStrings(impactDevices(impact)) != "iPad7,5" || impact.Kept != 0 || *impact.ExcludedShare != 100 || len(impact.Unmatched) != 1 {
+		t.Fatalf("Unexpected iPad impact: %+v", impact)
+	}
+
+	var buf bytes.Buffer
+	must(t, WriteImpact(&buf, Assess(ds, "ios", v("17.0"), "", weights), FormatTable))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[0] != "ios 17.0.0: 2 excluded devices, 3 kept, 40.00% of users excluded" || !strings.HasSuffix(lines[3], "16.7.0  30.00") {
+		t.Fatalf("Unexpected table:\n%s", buf.String())
+	}
+	buf.Reset()
+	must(t, WriteImpact(&buf, impact, FormatCSV))
+	if buf.String() != "hardware_string,model_name,device_family,cpu,min_os,max_os,share\n\"iPad7,5\",iPad (6th generation),iPad,,15.8.0,17.2.0,100.00\n" {
+		t.Fatalf("Unexpected CSV:\n%s", buf.String())
+	}
+	buf.Reset()
+	must(t, WriteImpact(&buf, impact, FormatJSON))
+	var back Impact
+	if err := json.Unmarshal(buf.Bytes(), &back); err != nil || !back.Target.Eq(v("18.0")) || len(back.Excluded) != 1 || *back.ExcludedShare != 100 {
+		t.Fatalf("Unexpected JSON impact: %s %v", buf.String(), err)
+	}
+}
+
+func impactDevices(i Impact) []Device {
+	var out []Device
+	for _, d := range i.Excluded {
+		out = append(out, d.Device)
+	}
+	return out
+}
@@ -0,0 +1,211 @@
+package compat
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/output"
+	"appledata/Packages/version"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Weights is the share of users of each device, as exported by analytics:
+// keys are hardware strings (iPhone10,3) or model names (iPhone X), values
+// any positive number (user counts, sessions or percentages) since only
+// their ratio matters.
+type Weights map[string]float64
+
+// ReadWeights reads weights from CSV rows of an identifier and a weight,
+// e.g. "iPhone10,3,1520" or "iPhone X,2.5%". A first row whose weight is
+// not a number is taken as a header, the weights of repeated identifiers
+// add up.
+func ReadWeights(r io.Reader) (Weights, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	weights := Weights{}
+	for i, row := range rows {
+		// unquoted hardware strings split in two fields, e.g. iPhone10,3,1520
+		if len(row) == 3 {
+			row = []string{row[0] + "," + row[1], row[2]}
+		}
+		if len(row) != 2 {
+			return nil, fmt.Errorf("line %d: expected a device and a weight, got %d fields", i+1, len(row))
+		}
+		key := strings.TrimSpace(row[0])
+		weight, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(row[1]), "%"), 64)
+		if err != nil {
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: bad weight %q", i+1, row[1])
+		}
+		if weight < 0 {
+			return nil, fmt.Errorf("line %d: negative weight %q", i+1, row[1])
+		}
+		weights[key] += weight
+	}
+	if len(weights) == 0 {
+		return nil, errors.New("no weights")
+	}
+	return weights, nil
+}
+
+// ImpactDevice is a device along with the share of users it accounts
+// for, nil without weights.
+type ImpactDevice struct {
+	Device
+	Share *float64 `json:"share,omitempty"`
+}
+
+// Impact is the effect of raising the deployment target of an app to
+// Target: the devices whose latest release is older than Target are
+// excluded, the others kept. Devices without any release of the family,
+// or outside the device family of the assessment, are not counted. Without
+// weights, ExcludedShare is nil and the impact is only known in device
+// models.
+type Impact struct {
+	Family   string            `json:"family"`
+	Target   version.OSVersion `json:"target"`
+	Excluded []ImpactDevice    `json:"excluded"`
+	Kept     int               `json:"kept"`
+	// ExcludedShare is the percentage of users of the counted devices on
+	// an excluded device
+	ExcludedShare *float64 `json:"excluded_share,omitempty"`
+	// Unmatched lists, sorted, the weight identifiers matching no device of
+	// the DB: they are left out of the percentages.
+	Unmatched []string `json:"unmatched,omitempty"`
+}
+
+// Assess computes the impact of raising the deployment target of family
+// to target on the devices of deviceFamily (case insensitive, all devices
+// when empty), weights being optional. A weight keyed by a model name is
+// split evenly between the counted devices of that name, and only excluded
+// when all of them are.
+func Assess(ds *dataset.Dataset, family string, target version.OSVersion, deviceFamily version.DeviceFamily, weights Weights) Impact {
+	impact := Impact{Family: family, Target: target, Excluded: []ImpactDevice{}}
+	var excludedDevices []Device
+	// counted devices, by hardware string, true when excluded
+	excluded := map[string]bool{}
+	known := map[string]bool{}
+	byName := map[string][]string{}
+	filter := dataset.DeviceFilter{Family: string(deviceFamily)}
+	for _, d := range ds.Devices {
+		known[d.Codename] = true
+		known[d.Modelname] = true
+		if !filter.Matches(d) {
+			continue
+		}
+		dev, runs := newDevice(d, family)
+		if runs == 0 {
+			continue
+		}
+		excluded[d.Codename] = dev.MaxOS.Lt(target)
+		byName[d.Modelname] = append(byName[d.Modelname], d.Codename)
+		if excluded[d.Codename] {
+			dev.Status = StatusDropped
+			excludedDevices = append(excludedDevices, dev)
+		} else {
+			impact.Kept++
+		}
+	}
+	sortDevices(excludedDevices)
+
+	var deviceWeight map[string]float64
+	if weights != nil {
+		deviceWeight = map[string]float64{}
+		keys := make([]string, 0, len(weights))
+		for key := range weights {
+			keys = append(keys, key)
+		}
+		// sorted for the float sums to be reproducible
+		sort.Strings(keys)
+		total, excludedWeight := 0.0, 0.0
+		for _, key := range keys {
+			devices := byName[key]
+			if _, counted := excluded[key]; counted {
+				devices = []string{key}
+			}
+			if len(devices) == 0 {
+				if !known[key] {
+					impact.Unmatched = append(impact.Unmatched, key)
+				}
+				continue
+			}
+			total += weights[key]
+			all := true
+			for _, hardwareString := range devices {
+				all = all && excluded[hardwareString]
+			}
+			if !all {
+				continue
+			}
+			excludedWeight += weights[key]
+			for _, hardwareString := range devices {
+				deviceWeight[hardwareString] += weights[key] / float64(len(devices))
+			}
+		}
+		for hardwareString := range deviceWeight {
+			deviceWeight[hardwareString] = percent(deviceWeight[hardwareString], total)
+		}
+		share := percent(excludedWeight, total)
+		impact.ExcludedShare = &share
+	}
+	for _, d := range excludedDevices {
+		dev := ImpactDevice{Device: d}
+		if deviceWeight != nil {
+			share := deviceWeight[d.HardwareString]
+			dev.Share = &share
+		}
+		impact.Excluded = append(impact.Excluded, dev)
+	}
+	return impact
+}
+
+func percent(w float64, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return w / total * 100
+}
+
+// WriteImpact writes i to w in format, one of Formats.
+func WriteImpact(w io.Writer, i Impact, format string) error {
+	return output.Writers{
+		FormatTable: func(w io.Writer) error {
+			summary := fmt.Sprintf("%s %s: %d excluded devices, %d kept", i.Family, i.Target.String(), len(i.Excluded), i.Kept)
+			if i.ExcludedShare != nil {
+				summary += fmt.Sprintf(", %.2f%% of users excluded", *i.ExcludedShare)
+			}
+			fmt.Fprintln(w, summary)
+			var rows [][]string
+			for _, d := range i.Excluded {
+				rows = append(rows, []string{d.HardwareString, d.ModelName, d.Cpu, d.MaxOS.String(), formatShare(d.Share)})
+			}
+			return output.Table(w, []string{"HARDWARE", "MODEL", "CPU", "MAX OS", "SHARE"}, rows)
+		},
+		FormatJSON: func(w io.Writer) error { return output.JSON(w, i) },
+		FormatCSV: func(w io.Writer) error {
+			var rows [][]string
+			for _, d := range i.Excluded {
+				rows = append(rows, []string{d.HardwareString, d.ModelName, d.DeviceFamily, d.Cpu, d.MinOS.String(), d.MaxOS.String(), formatShare(d.Share)})
+			}
+			return output.CSV(w, []string{"hardware_string", "model_name", "device_family", "cpu", "min_os", "max_os", "share"}, rows)
+		},
+	}.Write(w, format)
+}
+
+func formatShare(share *float64) string {
+	if share == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*share, 'f', 2, 64)
+}
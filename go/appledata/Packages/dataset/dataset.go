@@ -0,0 +1,193 @@
+package dataset
+
+import (
+	"appledata/Packages/dbtools"
+	"appledata/Packages/version"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Dataset is the whole content of a generated DB, loaded in memory and
+// sorted in a stable order: processors by code, releases by version,
+// devices by hardware string.
+type Dataset struct {
+	Processors []*Processor
+	Releases   []*Release
+	Devices    []*Device
+}
+
+type Processor struct {
+	Code  string
+	Label string
+}
+
+// Release is an OS version along with its build numbers. Devices lists,
+// sorted by hardware identifier (iPhone9,1 before iPhone10,1), the devices
+// supporting it.
+type Release struct {
+	Family   string
+	Version  version.OSVersion
+	Builds   []string
+	Darwin   *version.OSVersion // kernel version, nil when unknown
+	Released *time.Time         // release date, nil when unknown
+	Devices  []*Device
+}
+
+// Device is a single hardware string. Releases lists, oldest first, the OS
+// versions the device supports.
+type Device struct {
+	Codename  string
+	Modelname string
+	Cpu       *Processor // nil when unknown
+	Releases  []*Release
+}
+
+// MinOS returns the oldest OS version supported by the device, nil when
+// no release is linked to it.
+func (d *Device) MinOS() *version.OSVersion {
+	if len(d.Releases) == 0 {
+		return nil
+	}
+	return &d.Releases[0].Version
+}
+
+// MaxOS returns the latest OS version supported by the device, nil when
+// no release is linked to it.
+func (d *Device) MaxOS() *version.OSVersion {
+	if len(d.Releases) == 0 {
+		return nil
+	}
+	return &d.Releases[len(d.Releases)-1].Version
+}
+
+// DeviceFilter selects devices; empty fields match every device.
+type DeviceFilter struct {
+	Family   string             // device family, case insensitive
+	Cpu      string             // processor code or label
+	Model    string             // substring of the model name, case insensitive
+	Supports *version.OSVersion // version within the supported range
+}
+
+// Matches reports whether d is selected by the filter.
+func (f DeviceFilter) Matches(d *Device) bool {
+	if f.Family != "" && !strings.EqualFold(string(version.HardwareFamily(d.Codename)), f.Family) {
+		return false
+	}
+	if f.Cpu != "" && (d.Cpu == nil || (d.Cpu.Code != f.Cpu && d.Cpu.Label != f.Cpu)) {
+		return false
+	}
+	if f.Model != "" && !strings.Contains(strings.ToLower(d.Modelname), strings.ToLower(f.Model)) {
+		return false
+	}
+	if f.Supports != nil {
+		minos, maxos := d.MinOS(), d.MaxOS()
+		if minos == nil || f.Supports.Lt(*minos) || f.Supports.Gt(*maxos) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterDevices returns, in dataset order, the devices selected by f.
+func (ds *Dataset) FilterDevices(f DeviceFilter) []*Device {
+	matches := []*Device{}
+	for _, d := range ds.Devices {
+		if f.Matches(d) {
+			matches = append(matches, d)
+		}
+	}
+	return matches
+}
+
+// sortDevices sorts devices by hardware identifier, so that iPhone9,1
+// comes before iPhone10,1. Codenames that are not hardware identifiers go
+// last, in string order.
+func sortDevices(devices []*Device) {
+	sort.SliceStable(devices, func(i, j int) bool {
+		hi, erri := version.HardwareIdentifierFromString(devices[i].Codename)
+		hj, errj := version.HardwareIdentifierFromString(devices[j].Codename)
+		switch {
+		case erri != nil && errj != nil:
+			return devices[i].Codename < devices[j].Codename
+		case erri != nil || errj != nil:
+			return errj != nil
+		}
+		return hi.Lt(hj)
+	})
+}
+
+func sortReleases(releases []*Release) {
+	sort.SliceStable(releases, func(i, j int) bool {
+		if releases[i].Family != releases[j].Family {
+			return releases[i].Family < releases[j].Family
+		}
+		return releases[i].Version.Lt(releases[j].Version)
+	})
+}
+
+// Load reads the whole content of db.
+func Load(db *gorm.DB) (*Dataset, error) {
+	ds := &Dataset{}
+
+	var processors []dbtools.AppleProcessor
+	if err := db.Order("code").Find(&processors).Error; err != nil {
+		return nil, err
+	}
+	processorsByID := map[uint]*Processor{}
+	for _, p := range processors {
+		proc := &Processor{Code: p.Code, Label: p.Label}
+		processorsByID[p.ID] = proc
+		ds.Processors = append(ds.Processors, proc)
+	}
+
+	var oses []dbtools.OperatingSystem
+	if err := db.Preload("BuildNumbers").Find(&oses).Error; err != nil {
+		return nil, err
+	}
+	releasesByID := map[uint]*Release{}
+	for _, o := range oses {
+		rel := &Release{Family: o.Name, Version: version.OSVersion{X: o.VersionX, Y: o.VersionY, Z: o.VersionZ}, Darwin: o.DarwinVersion, Released: o.ReleaseDate}
+		for _, bn := range o.BuildNumbers {
+			rel.Builds = append(rel.Builds, bn.BuildNumber)
+		}
+		sort.Strings(rel.Builds)
+		releasesByID[o.ID] = rel
+		ds.Releases = append(ds.Releases, rel)
+	}
+	sortReleases(ds.Releases)
+
+	var devices []dbtools.Device
+	if err := db.Preload("OperatingSystems").Order("codename").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	for _, d := range devices {
+		dev := &Device{Codename: d.Codename, Modelname: d.Modelname, Cpu: processorsByID[uint(d.CpuID)]}
+		for _, o := range d.OperatingSystems {
+			rel := releasesByID[o.ID]
+			dev.Releases = append(dev.Releases, rel)
+			rel.Devices = append(rel.Devices, dev)
+		}
+		sortReleases(dev.Releases)
+		ds.Devices = append(ds.Devices, dev)
+	}
+	sortDevices(ds.Devices)
+	for _, rel := range ds.Releases {
+		sortDevices(rel.Devices)
+	}
+	return ds, nil
+}
+
+// LoadFile loads the DB file at dbfile.
+func LoadFile(dbfile string) (*Dataset, error) {
+	db, err := dbtools.OpenReadOnly(dbfile)
+	if err != nil {
+		return nil, err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	return Load(db)
+}
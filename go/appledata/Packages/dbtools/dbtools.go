@@ -2,17 +2,15 @@ package dbtools
 
 import (
 	"appledata/Packages/version"
-	"path"
-	"strings"
+	"fmt"
+	"time"
 
-	log "github.com/sirupsen/logrus"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
-var DB_NAME string = "appledata.sqlite"
-var DBRef *gorm.DB
+// DB_NAME is the default file name of the generated DB.
+const DB_NAME string = "appledata.sqlite"
 
 type AppleProcessor struct {
 	ID    uint   `gorm:"primaryKey"`
@@ -26,6 +24,25 @@ type Device struct {
 	CpuID            int
 	Cpu              AppleProcessor
 	OperatingSystems []*OperatingSystem `gorm:"many2many:device_os;"`
+	// Codename parsed as a version.HardwareIdentifier, for range queries.
+	// Left empty when the codename is not a valid hardware identifier.
+	HardwareFamily string `gorm:"index:idx_devices_hardware"`
+	HardwarePrefix string `gorm:"index:idx_devices_hardware"`
+	HardwareMajor  int    `gorm:"index:idx_devices_hardware"`
+	HardwareMinor  int    `gorm:"index:idx_devices_hardware"`
+}
+
+// newDevice returns the row of a device, with its hardware columns filled
+// from codename.
+func newDevice(model string, codename string) Device {
+	d := Device{Codename: codename, Modelname: model}
+	if hw, err := version.HardwareIdentifierFromString(codename); err == nil {
+		d.HardwareFamily = string(hw.Family())
+		d.HardwarePrefix = hw.Prefix
+		d.HardwareMajor = hw.Major
+		d.HardwareMinor = hw.Minor
+	}
+	return d
 }
 type OperatingSystem struct {
 	ID       uint      `gorm:"primaryKey"`
@@ -33,111 +50,78 @@ type OperatingSystem struct {
 	VersionX int       `gorm:"uniqueIndex:unique_version_idx"`
 	VersionY int       `gorm:"uniqueIndex:unique_version_idx"`
 	VersionZ int       `gorm:"uniqueIndex:unique_version_idx"`
+	// VersionX.VersionY.VersionZ in a single sortable column
+	Version  version.OSVersion `gorm:"index"`
+	// Darwin/XNU kernel version of the release, NULL when unknown
+	DarwinVersion *version.OSVersion
+	// release date of the version, NULL when unknown
+	ReleaseDate *time.Time
 	Models   []*Device `gorm:"many2many:device_os;"`
 	BuildNumbers []BuildNumber `gorm:"foreignKey:OperatingSystemRef"`
 }
+
+// newOperatingSystem returns the row of release v, without its builds.
+func newOperatingSystem(v version.IOSVersion) OperatingSystem {
+	return OperatingSystem{VersionX: v.Version.X, VersionY: v.Version.Y, VersionZ: v.Version.Z, Version: v.Version, DarwinVersion: v.Darwin, ReleaseDate: v.Released}
+}
 type BuildNumber struct {
 	ID       uint `gorm:"primaryKey"`
 	OperatingSystemRef  uint
 	BuildNumber string `gorm:"unique"`
 }
 type V_OS_model struct {
-	osver_x  string `gorm:"column:osver_x`
-	osver_y  string `gorm:"column:osver_y`
-	osver_z  string `gorm:"column:osver_z`
-	model    string `gorm:"column:model`
-	codename string `gorm:"column:codename`
-	cpu_abi  string `gorm:"column:cpu_abi`
+	osver_x  string `gorm:"column:osver_x"`
+	osver_y  string `gorm:"column:osver_y"`
+	osver_z  string `gorm:"column:osver_z"`
+	model    string `gorm:"column:model"`
+	codename string `gorm:"column:codename"`
+	cpu_abi  string `gorm:"column:cpu_abi"`
 }
 type V_OS_build struct {
-	osver_x  string `gorm:"column:osver_x`
-	osver_y  string `gorm:"column:osver_y`
-	osver_z  string `gorm:"column:osver_z`
-	build    string `gorm:"column:build`
+	osver_x  string `gorm:"column:osver_x"`
+	osver_y  string `gorm:"column:osver_y"`
+	osver_z  string `gorm:"column:osver_z"`
+	build    string `gorm:"column:build"`
+}
+// processors predating the ones listed by the scraped pages
+var earlyCPUs = []AppleProcessor{
+	{Code: "S5L8900", Label: "Samsung S5L8900"},
+	{Code: "S5L8920", Label: "Samsung S5PC100"},
 }
-func DBInit(dbbasepath string) {
-	var err error
 
-	fullpath := path.Join(dbbasepath, DB_NAME)
-	DBRef, err = gorm.Open(sqlite.Open(fullpath), &gorm.Config{})
-	if err != nil {
-		panic("failed to connect database")
-	}
-	// Migrate the schema
-	DBRef.AutoMigrate(&AppleProcessor{})
-	DBRef.AutoMigrate(&Device{})
-	DBRef.AutoMigrate(&OperatingSystem{})
-	DBRef.AutoMigrate(&BuildNumber{})
-	
-	var earlyCPUs = []AppleProcessor{
-		{Code: "S5L8900", Label: "Samsung S5L8900"},
-		{Code: "S5L8920", Label: "Samsung S5PC100"},
+func createSchema(tx *gorm.DB) error {
+	if err := Migrate(tx); err != nil {
+		return err
 	}
-	DBRef.Create(&earlyCPUs)
-
-	DBRef.Exec(`DROP VIEW IF EXISTS v_os_model;
-	CREATE VIEW v_os_model AS 
-	SELECT os.version_x, os.version_y, os.version_z, md.modelname, md.codename, ap.label cpu
-	FROM device_os do 
-	JOIN devices md ON md.id = do.device_id 
-    JOIN apple_processors ap on ap.id = md.cpu_id
-	JOIN operating_systems os ON os.id = do.operating_system_id`)
-
-	DBRef.Exec(`DROP VIEW IF EXISTS v_os_build;
-	CREATE VIEW v_os_build AS 
-	SELECT os.version_x, os.version_y, os.version_z, bn.build_number
-	FROM build_numbers bn 
-	JOIN operating_systems os ON os.id = bn.operating_system_ref`)
+	var seed = append([]AppleProcessor{}, earlyCPUs...)
+	return tx.Create(&seed).Error
 }
 
-func DBFlush() {
-	DBRef.Commit()
+// OpenReadOnly opens the DB file at dbfile without write access.
+func OpenReadOnly(dbfile string) (*gorm.DB, error) {
+	return gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=ro", dbfile)), &gorm.Config{})
 }
 
-func DBAddDevice(model string, codename string, cpuname string, minos version.OSVersion, maxos version.OSVersion) {
-	var device Device
-	var cpu AppleProcessor
-	DBRef.FirstOrCreate(&device, Device{Codename: codename, Modelname: model})
-	DBRef.Save(&device)
-
-	result := DBRef.Where(&AppleProcessor{Label: strings.Replace(cpuname, "Apple ", "", 1)}).First(&cpu)
-	if result.RowsAffected == 1 {
-		device.Cpu = cpu
-		log.Debugf("[DBAddDevice] setting cpu '%s' for device '%s' (%s)", cpuname, model, codename)
-		DBRef.Save(&device)
-	} else {
-		log.Warnf("[DBAddDevice] unknown cpu '%s' for device '%s' (%s)", cpuname, model, codename)
-	}
-	var osversions []OperatingSystem
-	var rng = version.OSVersionRange{
-		Left:  version.OSVersionRangeLimit{V: minos, Inclusive: true},
-		Right: version.OSVersionRangeLimit{V: maxos, Inclusive: true},
-	}
-	DBRef.Find(&osversions)
-	for _, v := range osversions {
-		var osver version.OSVersion = version.OSVersion{X: v.VersionX, Y: v.VersionY, Z: v.VersionZ}
-		if osver.InRange(rng) {
-			DBRef.Model(&device).Association("OperatingSystems").Append(&v)
+// DBCheck runs SQLite's integrity check, on SQLite DBs, and makes sure
+// the main tables have been populated.
+func DBCheck(db *gorm.DB) error {
+	if db.Dialector.Name() == DialectSQLite {
+		var result string
+		if err := db.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+			return err
+		}
+		if result != "ok" {
+			return fmt.Errorf("integrity_check: %s", result)
 		}
 	}
-}
-
-func DBUpdateCPU(code string, label string) {
-	var appproc AppleProcessor
-	DBRef.Where(AppleProcessor{Code: code}).Assign(AppleProcessor{Label: label}).FirstOrCreate(&appproc)
-	log.Infof("Adding/updating processor %s (%s)", appproc.Label, appproc.Code)
-}
-func DBAddIOSVersion(osVerObject version.IOSVersion) {
-	var operatingsystem = OperatingSystem{VersionX: osVerObject.Version.X, VersionY: osVerObject.Version.Y, VersionZ: osVerObject.Version.Z}
-	DBRef.Clauses(clause.OnConflict{DoNothing: true}).Create(&operatingsystem)
-	
-	for _, build := range osVerObject.Builds {
-		var buildNumber = BuildNumber{BuildNumber: build.String()}
-		DBRef.Model(&operatingsystem).Association("BuildNumbers").Append(&buildNumber)
+	for _, model := range []interface{}{&AppleProcessor{}, &Device{}, &OperatingSystem{}, &BuildNumber{}} {
+		var count int64
+		if err := db.Model(model).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("table for %T is empty", model)
+		}
 	}
+	return nil
 }
-// DEPRECATED
-func DBAddOSVersion(osVerObject version.OSVersion) {
-	var operatingsystem = OperatingSystem{VersionX: osVerObject.X, VersionY: osVerObject.Y, VersionZ: osVerObject.Z}
-	DBRef.Clauses(clause.OnConflict{DoNothing: true}).Create(&operatingsystem)
-}
\ No newline at end of file
@@ -0,0 +1,565 @@
+package dbtools
+
+import (
+	"appledata/Packages/version"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newStore(t *testing.T, dbfile string) *SQLStore {
+	s, err := NewSQLStore(dbfile, Options{})
+	if err != nil {
+		t.Fatalf("NewSQLStore: %s", err.Error())
+	}
+	return s
+}
+
+func populate(t *testing.T, s Store) {
+	must(t, s.UpdateCPU("A16_Bionic", "A16 Bionic"))
+	ver, _ := version.OSVersionFromString("17.0")
+	bn, _ := version.BuildNumberFromString("21A329")
+	must(t, s.AddIOSVersion(version.IOSVersion{Version: ver, Builds: []version.BuildNumber{bn}}))
+	must(t, s.AddDevice("iPhone 15", "iPhone15,4", "Apple A16 Bionic", ver, ver))
+}
+
+// rescrape feeds s with the second scrape of TestSync: device renamed,
+// 17.0 replaced by 17.0.1, new build
+func rescrape(t *testing.T, s Store) {
+	must(t, s.UpdateCPU("A16_Bionic", "A16 Bionic"))
+	ver, _ := version.OSVersionFromString("17.0.1")
+	bn, _ := version.BuildNumberFromString("21A340")
+	must(t, s.AddIOSVersion(version.IOSVersion{Version: ver, Builds: []version.BuildNumber{bn}}))
+	must(t, s.AddDevice("iPhone 15 (renamed)", "iPhone15,4", "Apple A16 Bionic", ver, ver))
+}
+
+var syncChanges = []string{
+	"insert os_version 17.0.1",
+	"insert build 21A340 (17.0.1)",
+	`update device iPhone15,4 (modelname: "iPhone 15" -> "iPhone 15 (renamed)")`,
+	"insert device_os iPhone15,4@17.0.1",
+	"delete device_os iPhone15,4@17.0.0",
+	"delete build 21A329 (17.0.0)",
+	"delete os_version 17.0.0",
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+}
+
+func checkChanges(t *testing.T, changes []Change) {
+	t.Helper()
+	if len(changes) != len(syncChanges) {
+		t.Fatalf("Expected %d changes, got %d: %v", len(syncChanges), len(changes), changes)
+	}
+	for i, c := range changes {
+		if c.String() != syncChanges[i] {
+			t.Fatalf("Expected change %q, got %q", syncChanges[i], c.String())
+		}
+	}
+}
+
+func TestAtomicGeneration(t *testing.T) {
+	dir := t.TempDir()
+	final := path.Join(dir, DB_NAME)
+
+	s := newStore(t, final)
+	if _, err := os.Stat(final); !os.IsNotExist(err) {
+		t.Fatalf("%s must not exist before Flush", final)
+	}
+	populate(t, s)
+	if err := s.Flush(BuildMetadata{Mode: "generate"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	// Abort is a no-op once the store is flushed
+	s.Abort()
+	first, err := os.ReadFile(final)
+	if err != nil {
+		t.Fatalf("%s should exist after Flush: %s", final, err.Error())
+	}
+
+	// an aborted run keeps the previous db and leaves no temporary files
+	newStore(t, final).Abort()
+	second, _ := os.ReadFile(final)
+	if string(first) != string(second) {
+		t.Fatalf("%s was modified by an aborted run", final)
+	}
+	// an empty run fails the checks and is discarded as well
+	if err := newStore(t, final).Flush(BuildMetadata{Mode: "generate"}); err == nil {
+		t.Fatalf("Flush should fail on an empty database")
+	}
+	leftovers, _ := filepath.Glob(path.Join(dir, "*.tmp"))
+	if len(leftovers) > 0 {
+		t.Fatalf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestSync(t *testing.T) {
+	dbfile := path.Join(t.TempDir(), DB_NAME)
+	s := newStore(t, dbfile)
+	populate(t, s)
+	if err := s.Flush(BuildMetadata{Mode: "generate"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+
+	s = newStore(t, dbfile)
+	rescrape(t, s)
+	changes, err := s.Sync(BuildMetadata{Mode: "sync"})
+	if err != nil {
+		t.Fatalf("Sync: %s", err.Error())
+	}
+	checkChanges(t, changes)
+
+	db, err := gorm.Open(sqlite.Open(dbfile), &gorm.Config{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	var logged int64
+	db.Model(&Changelog{}).Count(&logged)
+	if logged != int64(len(syncChanges)) {
+		t.Fatalf("Expected %d changelog rows, got %d", len(syncChanges), logged)
+	}
+	snap, _ := LoadSnapshot(db)
+	if snap.Devices["iPhone15,4"].Modelname != "iPhone 15 (renamed)" || !snap.DeviceOS["iPhone15,4@17.0.1"] || len(snap.DeviceOS) != 1 {
+		t.Fatalf("Unexpected db content after sync: %+v", snap)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+}
+
+func TestInitialSync(t *testing.T) {
+	dbfile := path.Join(t.TempDir(), DB_NAME)
+	s := newStore(t, dbfile)
+	populate(t, s)
+	changes, err := s.Sync(BuildMetadata{Mode: "sync"})
+	if err != nil {
+		t.Fatalf("Sync: %s", err.Error())
+	}
+	if len(changes) == 0 {
+		t.Fatalf("Syncing into a missing db should insert every row")
+	}
+	for _, c := range changes {
+		if c.Action != ChangeInsert || !c.Initial {
+			t.Fatalf("Expected an initial insert, got %+v", c)
+		}
+	}
+
+	s = newStore(t, dbfile)
+	rescrape(t, s)
+	changes, err = s.Sync(BuildMetadata{Mode: "sync"})
+	if err != nil {
+		t.Fatalf("Sync: %s", err.Error())
+	}
+	checkChanges(t, changes)
+	for _, c := range changes {
+		if c.Initial {
+			t.Fatalf("Changes over an existing db are not initial: %+v", c)
+		}
+	}
+}
+
+func TestDiffVersionOrder(t *testing.T) {
+	old := emptySnapshot()
+	new := emptySnapshot()
+	for _, ver := range []string{"17.10.0", "17.2.0", "17.9.0"} {
+		new.Versions[ver] = true
+		new.DeviceOS[deviceOSKey("iPhone15,4", ver)] = true
+	}
+	var got []string
+	for _, c := range DiffSnapshots(old, new) {
+		got = append(got, c.Key)
+	}
+	expected := "17.2.0 17.9.0 17.10.0 iPhone15,4@17.2.0 iPhone15,4@17.9.0 iPhone15,4@17.10.0"
+	if strings.Join(got, " ") != expected {
+		t.Fatalf("Expected changes %s, got %s", expected, strings.Join(got, " "))
+	}
+}
+
+func TestSchemaCompatibility(t *testing.T) {
+	dbfile := path.Join(t.TempDir(), DB_NAME)
+	s := newStore(t, dbfile)
+	populate(t, s)
+	if err := s.Flush(BuildMetadata{Mode: "generate"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	actual, err := CheckSchema(dbfile, SchemaVersion)
+	if err != nil || actual != SchemaVersion {
+		t.Fatalf("Expected compatible schema version %d, got %d: %v", SchemaVersion, actual, err)
+	}
+	if _, err := CheckSchema(dbfile, SchemaVersion+1); err == nil {
+		t.Fatalf("A db at version %d should not satisfy a consumer expecting %d", SchemaVersion, SchemaVersion+1)
+	}
+
+	applied := []SchemaInfo{{Version: 1}, {Version: 2}, {Version: 3, Breaking: true}, {Version: 4}}
+	if _, err := SchemaCompatible(applied, 2); err == nil {
+		t.Fatalf("Breaking migration 3 should make version 4 incompatible with consumers of version 2")
+	}
+	if actual, err := SchemaCompatible(applied, 3); err != nil || actual != 4 {
+		t.Fatalf("Version 4 should be compatible with consumers of version 3: %v", err)
+	}
+}
+
+func TestHardwareColumns(t *testing.T) {
+	dbfile := path.Join(t.TempDir(), DB_NAME)
+	s := newStore(t, dbfile)
+	populate(t, s)
+	if err := s.Flush(BuildMetadata{Mode: "generate"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	db, err := gorm.Open(sqlite.Open(dbfile), &gorm.Config{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+	var d Device
+	db.First(&d, "codename = ?", "iPhone15,4")
+	if d.HardwareFamily != "iPhone" || d.HardwarePrefix != "iPhone" || d.HardwareMajor != 15 || d.HardwareMinor != 4 {
+		t.Fatalf("Unexpected hardware columns: %+v", d)
+	}
+
+	// a db from before version 4 gets its existing devices backfilled
+	db.Exec("UPDATE devices SET hardware_family = '', hardware_prefix = '', hardware_major = 0, hardware_minor = 0")
+	db.Exec("DELETE FROM schema_info WHERE version >= 4")
+	must(t, Migrate(db))
+	db.First(&d, "codename = ?", "iPhone15,4")
+	if d.HardwareFamily != "iPhone" || d.HardwareMajor != 15 || d.HardwareMinor != 4 {
+		t.Fatalf("Hardware columns were not backfilled: %+v", d)
+	}
+}
+
+func TestDeviceListedTwice(t *testing.T) {
+	dbfile := path.Join(t.TempDir(), DB_NAME)
+	s := newStore(t, dbfile)
+	populate(t, s)
+	ver, _ := version.OSVersionFromString("17.0")
+	// the same codename under another model name, e.g. on a second table
+	if err := s.AddDevice("iPhone 15 (China)", "iPhone15,4", "Apple A16 Bionic", ver, ver); err != nil {
+		t.Fatalf("A device listed twice should be updated: %s", err.Error())
+	}
+	must(t, s.Flush(BuildMetadata{Mode: "generate"}))
+	db, err := OpenReadOnly(dbfile)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+	snap, err := LoadSnapshot(db)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(snap.Devices) != 1 || snap.Devices["iPhone15,4"].Modelname != "iPhone 15 (China)" || len(snap.DeviceOS) != 1 {
+		t.Fatalf("Unexpected devices: %+v %v", snap.Devices, snap.DeviceOS)
+	}
+}
+
+func TestVersionColumn(t *testing.T) {
+	dbfile := path.Join(t.TempDir(), DB_NAME)
+	s := newStore(t, dbfile)
+	populate(t, s)
+	ver, _ := version.OSVersionFromString("16.4.1")
+	must(t, s.AddIOSVersion(version.IOSVersion{Version: ver}))
+	if err := s.Flush(BuildMetadata{Mode: "generate"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	db, err := gorm.Open(sqlite.Open(dbfile), &gorm.Config{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+	check := func() {
+		t.Helper()
+		var releases []OperatingSystem
+		must(t, db.Order("version DESC").Find(&releases).Error)
+		if len(releases) != 2 || releases[0].Version.String() != "17.0.0" || releases[1].Version.String() != "16.4.1" {
+			t.Fatalf("Unexpected releases ordered by version: %+v", releases)
+		}
+		var raw int64
+		db.Raw("SELECT version FROM operating_systems WHERE version_x = 16").Scan(&raw)
+		if raw != 16004001 {
+			t.Fatalf("Unexpected stored version %d", raw)
+		}
+	}
+	check()
+
+	// a db from before version 5 gets its existing versions backfilled
+	db.Exec("UPDATE operating_systems SET version = 0")
+	db.Exec("DELETE FROM schema_info WHERE version >= 5")
+	must(t, Migrate(db))
+	check()
+}
+
+func TestDarwinVersion(t *testing.T) {
+	dbfile := path.Join(t.TempDir(), DB_NAME)
+	s := newStore(t, dbfile)
+	populate(t, s)
+	if err := s.Flush(BuildMetadata{Mode: "generate"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	ver, _ := version.OSVersionFromString("17.0")
+	bn, _ := version.BuildNumberFromString("21A329")
+	resync := func(darwin *version.OSVersion, expected string) {
+		t.Helper()
+		s := newStore(t, dbfile)
+		must(t, s.UpdateCPU("A16_Bionic", "A16 Bionic"))
+		must(t, s.AddIOSVersion(version.IOSVersion{Version: ver, Builds: []version.BuildNumber{bn}, Darwin: darwin}))
+		must(t, s.AddDevice("iPhone 15", "iPhone15,4", "Apple A16 Bionic", ver, ver))
+		changes, err := s.Sync(BuildMetadata{Mode: "sync"})
+		if err != nil {
+			t.Fatalf("Sync: %s", err.Error())
+		}
+		if len(changes) != 1 || changes[0].String() != expected {
+			t.Fatalf("Expected %q, got %v", expected, changes)
+		}
+	}
+	read := func() *version.OSVersion {
+		t.Helper()
+		db, err := OpenReadOnly(dbfile)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		defer func() {
+			sqlDB, _ := db.DB()
+			sqlDB.Close()
+		}()
+		var opsys OperatingSystem
+		must(t, db.First(&opsys, "version_x = 17").Error)
+		return opsys.DarwinVersion
+	}
+
+	darwin, _ := version.OSVersionFromString("23.0.0")
+	resync(&darwin, `update os_version 17.0.0 (darwin: "" -> "23.0.0")`)
+	if d := read(); d == nil || !d.Eq(darwin) {
+		t.Fatalf("Expected darwin 23.0.0, got %v", d)
+	}
+	resync(nil, `update os_version 17.0.0 (darwin: "23.0.0" -> "")`)
+	if d := read(); d != nil {
+		t.Fatalf("Expected no darwin version, got %s", d.String())
+	}
+}
+
+func TestDeviceTimelines(t *testing.T) {
+	dbfile := path.Join(t.TempDir(), DB_NAME)
+	date := func(s string) *time.Time {
+		d, _ := time.Parse(version.ReleaseDateLayout, s)
+		return &d
+	}
+	scrape := func(s Store, lastUpdate *time.Time) {
+		t.Helper()
+		must(t, s.UpdateCPU("A16_Bionic", "A16 Bionic"))
+		for _, rel := range []struct {
+			ver, build string
+			released   *time.Time
+		}{{"16.0", "20A362", date("2022-09-12")}, {"17.0", "21A329", date("2023-09-18")}, {"17.7", "21H16", lastUpdate}, {"18.0", "22A3354", date("2024-09-16")}} {
+			ver, _ := version.OSVersionFromString(rel.ver)
+			bn, _ := version.BuildNumberFromString(rel.build)
+			must(t, s.AddIOSVersion(version.IOSVersion{Version: ver, Builds: []version.BuildNumber{bn}, Released: rel.released}))
+		}
+		v16, _ := version.OSVersionFromString("16.0")
+		v17, _ := version.OSVersionFromString("17.7")
+		v18, _ := version.OSVersionFromString("18.0")
+		must(t, s.AddDevice("iPhone X", "iPhone10,3", "Apple A11 Bionic", v16, v16))
+		must(t, s.AddDevice("iPhone XS", "iPhone11,2", "Apple A12 Bionic", v16, v17))
+		must(t, s.AddDevice("iPhone 15", "iPhone15,4", "Apple A16 Bionic", v17, v18))
+	}
+	read := func() map[string]DeviceTimeline {
+		t.Helper()
+		db, err := OpenReadOnly(dbfile)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		defer func() {
+			sqlDB, _ := db.DB()
+			sqlDB.Close()
+		}()
+		var timelines []DeviceTimeline
+		must(t, db.Find(&timelines).Error)
+		out := map[string]DeviceTimeline{}
+		for _, tl := range timelines {
+			out[tl.Codename] = tl
+		}
+		return out
+	}
+
+	s := newStore(t, dbfile)
+	scrape(s, date("2024-09-16"))
+	must(t, s.Flush(BuildMetadata{Mode: "generate"}))
+	timelines := read()
+	if len(timelines) != 3 {
+		t.Fatalf("Expected 3 timelines, got %+v", timelines)
+	}
+	x := timelines["iPhone10,3"]
+	if x.ShippingOS.String() != "16.0.0" || x.LastMajor != 16 || x.SupportYears == nil || *x.SupportYears != 0 || x.DroppedBy == nil || *x.DroppedBy != 17 {
+		t.Fatalf("Unexpected iPhone X timeline: %+v", x)
+	}
+	xs := timelines["iPhone11,2"]
+	if xs.LastUpdate.String() != "17.7.0" || xs.SupportYears == nil || *xs.SupportYears != 2.01 || xs.DroppedBy == nil || *xs.DroppedBy != 18 {
+		t.Fatalf("Unexpected iPhone XS timeline: %+v", xs)
+	}
+	if latest := timelines["iPhone15,4"]; latest.LastMajor != 18 || latest.DroppedBy != nil {
+		t.Fatalf("A device running the latest major version should not be dropped: %+v", latest)
+	}
+
+	// an unknown release date leaves the support span unknown
+	s = newStore(t, dbfile)
+	scrape(s, nil)
+	changes, err := s.Sync(BuildMetadata{Mode: "sync"})
+	if err != nil {
+		t.Fatalf("Sync: %s", err.Error())
+	}
+	expected := `update os_version 17.7.0 (released: "2024-09-16" -> "")`
+	if len(changes) != 1 || changes[0].String() != expected {
+		t.Fatalf("Expected %q, got %v", expected, changes)
+	}
+	xs = read()["iPhone11,2"]
+	if xs.LastUpdateDate != nil || xs.SupportYears != nil {
+		t.Fatalf("Expected an unknown support span, got %+v", xs)
+	}
+}
+
+func TestBuildMetadata(t *testing.T) {
+	dbfile := path.Join(t.TempDir(), DB_NAME)
+	s := newStore(t, dbfile)
+	populate(t, s)
+	meta := BuildMetadata{
+		GeneratorVersion: "1.2.3",
+		Mode:             "generate",
+		PageRevisions:    []BuildPageRevision{{URL: "https://en.wikipedia.org/wiki/IOS_17", RevisionID: 42}},
+		Warnings:         2,
+	}
+	if err := s.Flush(meta); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	runs, err := ReadMetadata(dbfile)
+	if err != nil {
+		t.Fatalf("ReadMetadata: %s", err.Error())
+	}
+	if len(runs) != 1 || runs[0].GeneratorVersion != "1.2.3" || runs[0].Warnings != 2 || runs[0].SchemaVersion != SchemaVersion {
+		t.Fatalf("Unexpected metadata: %+v", runs)
+	}
+	if len(runs[0].PageRevisions) != 1 || runs[0].PageRevisions[0].RevisionID != 42 {
+		t.Fatalf("Unexpected page revisions: %+v", runs[0].PageRevisions)
+	}
+	counts := map[string]int64{}
+	for _, c := range runs[0].RowCounts {
+		counts[c.Name] = c.RowCount
+	}
+	if counts["devices"] != 1 || counts["device_os"] != 1 || counts["apple_processors"] != 3 {
+		t.Fatalf("Unexpected row counts: %v", counts)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	m := NewMemoryStore()
+	if err := m.Flush(BuildMetadata{Mode: "generate"}); err == nil {
+		t.Fatalf("Flush should fail on an empty store")
+	}
+	populate(t, m)
+	m.Abort()
+	if len(m.Snapshot().Devices) != 0 {
+		t.Fatalf("Aborted content was committed: %+v", m.Snapshot())
+	}
+	populate(t, m)
+	must(t, m.Flush(BuildMetadata{Mode: "generate"}))
+	snap := m.Snapshot()
+	if snap.Devices["iPhone15,4"].Cpu != "A16_Bionic" || !snap.DeviceOS["iPhone15,4@17.0.0"] || len(snap.Processors) != 3 {
+		t.Fatalf("Unexpected store content: %+v", snap)
+	}
+
+	// the in-memory store reports the same changes as the SQLite one
+	rescrape(t, m)
+	changes, err := m.Sync(BuildMetadata{Mode: "sync"})
+	if err != nil {
+		t.Fatalf("Sync: %s", err.Error())
+	}
+	checkChanges(t, changes)
+	if runs := m.Metadata(); len(runs) != 2 || runs[0].Mode != "sync" || runs[0].SchemaVersion != SchemaVersion {
+		t.Fatalf("Unexpected metadata: %+v", runs)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	for target, expected := range map[string][2]string{
+		"build/appledata.sqlite":                    {DialectSQLite, "build/appledata.sqlite"},
+		"postgres://u:p@localhost/appledata":        {DialectPostgres, "postgres://u:p@localhost/appledata"},
+		"postgresql://localhost/appledata":          {DialectPostgres, "postgresql://localhost/appledata"},
+		"mysql://u:p@tcp(localhost:3306)/appledata": {DialectMySQL, "u:p@tcp(localhost:3306)/appledata"},
+	} {
+		dialect, dsn := ParseTarget(target)
+		if dialect != expected[0] || dsn != expected[1] {
+			t.Fatalf("ParseTarget(%q): expected %v, got %s %s", target, expected, dialect, dsn)
+		}
+	}
+}
+
+func TestViewStatements(t *testing.T) {
+	for _, dialect := range []string{DialectSQLite, DialectPostgres, DialectMySQL} {
+		for _, stmt := range viewStatements(dialect) {
+			if strings.Contains(stmt, ";") {
+				t.Fatalf("%s: a statement must not contain several ones: %s", dialect, stmt)
+			}
+			if dialect == DialectSQLite && strings.Contains(stmt, "OR REPLACE") {
+				t.Fatalf("SQLite has no CREATE OR REPLACE VIEW: %s", stmt)
+			}
+			if dialect != DialectSQLite && strings.HasPrefix(stmt, "DROP") {
+				t.Fatalf("%s: views are replaced, not dropped: %s", dialect, stmt)
+			}
+		}
+	}
+}
+
+// TestServerTargets runs a generation and a sync against the databases
+// given by APPLEDATA_TEST_POSTGRES and APPLEDATA_TEST_MYSQL, e.g. the
+// services of docker-compose.yml. Their content is replaced.
+func TestServerTargets(t *testing.T) {
+	for _, env := range []string{"APPLEDATA_TEST_POSTGRES", "APPLEDATA_TEST_MYSQL"} {
+		t.Run(env, func(t *testing.T) {
+			target := os.Getenv(env)
+			if target == "" {
+				t.Skipf("%s not set", env)
+			}
+			s := newStore(t, target)
+			populate(t, s)
+			must(t, s.Flush(BuildMetadata{Mode: "generate"}))
+
+			s = newStore(t, target)
+			rescrape(t, s)
+			changes, err := s.Sync(BuildMetadata{Mode: "sync"})
+			if err != nil {
+				t.Fatalf("Sync: %s", err.Error())
+			}
+			checkChanges(t, changes)
+
+			dialect, dsn := ParseTarget(target)
+			db, err := Options{}.open(dialect, dsn)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+			var rows []map[string]interface{}
+			if err := db.Raw("SELECT modelname, cpu FROM v_os_model").Scan(&rows).Error; err != nil {
+				t.Fatalf("v_os_model: %s", err.Error())
+			}
+			if len(rows) != 1 || rows[0]["modelname"] != "iPhone 15 (renamed)" {
+				t.Fatalf("Unexpected v_os_model content: %v", rows)
+			}
+			sqlDB, _ := db.DB()
+			sqlDB.Close()
+		})
+	}
+}
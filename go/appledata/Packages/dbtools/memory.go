@@ -0,0 +1,189 @@
+package dbtools
+
+import (
+	"appledata/Packages/version"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MemoryStore is a Store keeping its content in memory, as a Snapshot. It
+// follows the same rules as SQLStore and is meant for tests of code
+// feeding a Store.
+type MemoryStore struct {
+	pending   Snapshot
+	committed Snapshot
+	metadata  []BuildMetadata
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func emptySnapshot() Snapshot {
+	return Snapshot{
+		Processors: map[string]string{},
+		Versions:   map[string]bool{},
+		Darwin:     map[string]string{},
+		Released:   map[string]string{},
+		Builds:     map[string]string{},
+		Devices:    map[string]SnapshotDevice{},
+		DeviceOS:   map[string]bool{},
+	}
+}
+
+func copySnapshot(snap Snapshot) Snapshot {
+	out := emptySnapshot()
+	for k, v := range snap.Processors {
+		out.Processors[k] = v
+	}
+	for k, v := range snap.Versions {
+		out.Versions[k] = v
+	}
+	for k, v := range snap.Darwin {
+		out.Darwin[k] = v
+	}
+	for k, v := range snap.Released {
+		out.Released[k] = v
+	}
+	for k, v := range snap.Builds {
+		out.Builds[k] = v
+	}
+	for k, v := range snap.Devices {
+		out.Devices[k] = v
+	}
+	for k, v := range snap.DeviceOS {
+		out.DeviceOS[k] = v
+	}
+	return out
+}
+
+// NewMemoryStore returns an empty store, seeded like a new SQLite DB.
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{committed: emptySnapshot()}
+	m.Abort()
+	return m
+}
+
+func (m *MemoryStore) UpdateCPU(code string, label string) error {
+	m.pending.Processors[code] = label
+	return nil
+}
+
+func (m *MemoryStore) AddIOSVersion(v version.IOSVersion) error {
+	key := v.Version.String()
+	m.pending.Versions[key] = true
+	if v.Darwin != nil {
+		m.pending.Darwin[key] = v.Darwin.String()
+	} else {
+		delete(m.pending.Darwin, key)
+	}
+	if v.Released != nil {
+		m.pending.Released[key] = v.Released.Format(version.ReleaseDateLayout)
+	} else {
+		delete(m.pending.Released, key)
+	}
+	for _, b := range v.Builds {
+		if owner, exists := m.pending.Builds[b.String()]; exists && owner != key {
+			return fmt.Errorf("build %s of %s already belongs to %s", b.String(), key, owner)
+		}
+		m.pending.Builds[b.String()] = key
+	}
+	return nil
+}
+
+func (m *MemoryStore) AddDevice(model string, codename string, cpuname string, minos version.OSVersion, maxos version.OSVersion) error {
+	device, exists := m.pending.Devices[codename]
+	if !exists {
+		device = SnapshotDevice{Modelname: model}
+	}
+	label := strings.Replace(cpuname, "Apple ", "", 1)
+	found := false
+	for _, code := range sortedKeys(m.pending.Processors) {
+		if m.pending.Processors[code] == label {
+			device.Cpu = code
+			found = true
+			break
+		}
+	}
+	if !found {
+		log.Warnf("[AddDevice] unknown cpu '%s' for device '%s' (%s)", cpuname, model, codename)
+	}
+	m.pending.Devices[codename] = device
+
+	var rng = version.OSVersionRange{
+		Left:  version.OSVersionRangeLimit{V: minos, Inclusive: true},
+		Right: version.OSVersionRangeLimit{V: maxos, Inclusive: true},
+	}
+	for key := range m.pending.Versions {
+		osver, err := version.OSVersionFromString(key)
+		if err != nil {
+			return err
+		}
+		if osver.InRange(rng) {
+			m.pending.DeviceOS[deviceOSKey(codename, key)] = true
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) check() error {
+	if len(m.pending.Processors) == 0 || len(m.pending.Devices) == 0 || len(m.pending.Versions) == 0 || len(m.pending.Builds) == 0 {
+		return errors.New("processors, devices, versions and builds must not be empty")
+	}
+	return nil
+}
+
+func (m *MemoryStore) record(meta BuildMetadata) {
+	meta.SchemaVersion = SchemaVersion
+	meta.FinishedAt = time.Now().UTC()
+	m.metadata = append([]BuildMetadata{meta}, m.metadata...)
+}
+
+// Flush replaces the committed content with the pending one.
+func (m *MemoryStore) Flush(meta BuildMetadata) error {
+	if err := m.check(); err != nil {
+		m.Abort()
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	m.committed = m.pending
+	m.record(meta)
+	m.Abort()
+	return nil
+}
+
+// Sync replaces the committed content with the pending one and returns
+// the differences between the two.
+func (m *MemoryStore) Sync(meta BuildMetadata) ([]Change, error) {
+	if err := m.check(); err != nil {
+		m.Abort()
+		return nil, fmt.Errorf("integrity check failed on scraped data: %w", err)
+	}
+	changes := DiffSnapshots(m.committed, m.pending)
+	markInitial(m.committed, changes)
+	m.committed = m.pending
+	m.record(meta)
+	m.Abort()
+	return changes, nil
+}
+
+// Abort discards the pending content and starts over with the seed
+// processors.
+func (m *MemoryStore) Abort() {
+	m.pending = emptySnapshot()
+	for _, cpu := range earlyCPUs {
+		m.pending.Processors[cpu.Code] = cpu.Label
+	}
+}
+
+// Snapshot returns a copy of the content committed by the last Flush or
+// Sync.
+func (m *MemoryStore) Snapshot() Snapshot {
+	return copySnapshot(m.committed)
+}
+
+// Metadata returns the metadata of every Flush and Sync, newest first.
+func (m *MemoryStore) Metadata() []BuildMetadata {
+	return append([]BuildMetadata{}, m.metadata...)
+}
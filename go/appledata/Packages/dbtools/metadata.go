@@ -0,0 +1,90 @@
+package dbtools
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BuildMetadata describes one generator run. A row is added at the end of
+// every successful generate or sync run, so a synced DB holds its whole
+// history while a regenerated one holds a single row.
+type BuildMetadata struct {
+	ID               uint `gorm:"primaryKey"`
+	GeneratorVersion string
+	SchemaVersion    int
+	Mode             string // generate or sync
+	StartedAt        time.Time
+	FinishedAt       time.Time
+	Sources          string // comma separated list of enabled sources
+	Warnings         int
+	Errors           int
+	PageRevisions    []BuildPageRevision `gorm:"foreignKey:BuildMetadataID"`
+	RowCounts        []BuildRowCount     `gorm:"foreignKey:BuildMetadataID"`
+}
+
+func (BuildMetadata) TableName() string {
+	return "build_metadata"
+}
+
+// BuildPageRevision is the revision of a source page parsed during a run.
+type BuildPageRevision struct {
+	ID              uint `gorm:"primaryKey"`
+	BuildMetadataID uint
+	URL             string
+	RevisionID      int64
+}
+
+// BuildRowCount is the number of rows of a table at the end of a run.
+type BuildRowCount struct {
+	ID              uint `gorm:"primaryKey"`
+	BuildMetadataID uint
+	Name            string
+	RowCount        int64
+}
+
+// tables whose row count is stored in the build metadata
+var countedTables = []string{"apple_processors", "devices", "operating_systems", "build_numbers", "device_os"}
+
+func (m BuildMetadata) String() string {
+	return fmt.Sprintf("generator %s (schema %d), %s run from %s to %s, %d warnings, %d errors",
+		m.GeneratorVersion, m.SchemaVersion, m.Mode,
+		m.StartedAt.Format(time.RFC3339), m.FinishedAt.Format(time.RFC3339), m.Warnings, m.Errors)
+}
+
+// writeMetadata completes meta with the schema version, finish time and
+// row counts of db, and stores it.
+func writeMetadata(db *gorm.DB, meta BuildMetadata) error {
+	meta.SchemaVersion = SchemaVersion
+	meta.FinishedAt = time.Now().UTC()
+	meta.RowCounts = nil
+	for _, table := range countedTables {
+		var count int64
+		if err := db.Table(table).Count(&count).Error; err != nil {
+			return err
+		}
+		meta.RowCounts = append(meta.RowCounts, BuildRowCount{Name: table, RowCount: count})
+	}
+	return db.Create(&meta).Error
+}
+
+// ReadMetadata opens the DB file at dbfile read-only and returns its build
+// metadata, most recent run first.
+func ReadMetadata(dbfile string) ([]BuildMetadata, error) {
+	db, err := OpenReadOnly(dbfile)
+	if err != nil {
+		return nil, err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	var runs []BuildMetadata
+	if !db.Migrator().HasTable(&BuildMetadata{}) {
+		return runs, nil
+	}
+	err = db.Preload("PageRevisions", func(tx *gorm.DB) *gorm.DB { return tx.Order("url") }).
+		Preload("RowCounts", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).
+		Order("id DESC").Find(&runs).Error
+	return runs, err
+}
@@ -0,0 +1,362 @@
+package dbtools
+
+import (
+	"appledata/Packages/version"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// SchemaInfo has one row per applied migration. The schema version of a
+// DB is the highest Version found in this table.
+type SchemaInfo struct {
+	Version     int `gorm:"primaryKey;autoIncrement:false"`
+	Description string
+	Breaking    bool
+	AppliedAt   time.Time
+}
+
+func (SchemaInfo) TableName() string {
+	return "schema_info"
+}
+
+// A migration brings the schema from Version-1 to Version. Migrations must
+// never change once released: the models they use are frozen copies of
+// the ones in dbtools.go at the time the migration was written, and any
+// data that needs converting is converted inside Up.
+// Breaking is set when queries written against the previous version may
+// stop working (renamed/removed columns or tables, changed semantics).
+type migration struct {
+	Version     int
+	Description string
+	Breaking    bool
+	Up          func(tx *gorm.DB) error
+}
+
+// schema as of version 1
+type v1AppleProcessor struct {
+	ID    uint   `gorm:"primaryKey"`
+	Code  string `gorm:"unique"`
+	Label string
+}
+
+func (v1AppleProcessor) TableName() string { return "apple_processors" }
+
+type v1Device struct {
+	ID               uint `gorm:"primaryKey"`
+	Modelname        string
+	Codename         string `gorm:"unique"`
+	CpuID            int
+	Cpu              v1AppleProcessor
+	OperatingSystems []*v1OperatingSystem `gorm:"many2many:device_os;joinForeignKey:DeviceID;joinReferences:OperatingSystemID"`
+}
+
+func (v1Device) TableName() string { return "devices" }
+
+type v1OperatingSystem struct {
+	ID           uint            `gorm:"primaryKey"`
+	Name         string          `gorm:"default:ios"`
+	VersionX     int             `gorm:"uniqueIndex:unique_version_idx"`
+	VersionY     int             `gorm:"uniqueIndex:unique_version_idx"`
+	VersionZ     int             `gorm:"uniqueIndex:unique_version_idx"`
+	BuildNumbers []v1BuildNumber `gorm:"foreignKey:OperatingSystemRef"`
+}
+
+func (v1OperatingSystem) TableName() string { return "operating_systems" }
+
+type v1BuildNumber struct {
+	ID                 uint `gorm:"primaryKey"`
+	OperatingSystemRef uint
+	BuildNumber        string `gorm:"unique"`
+}
+
+func (v1BuildNumber) TableName() string { return "build_numbers" }
+
+// schema as of version 2
+type v2Changelog struct {
+	ID     uint      `gorm:"primaryKey"`
+	RunAt  time.Time `gorm:"index"`
+	Action string
+	Entity string
+	Key    string
+	Detail string
+}
+
+func (v2Changelog) TableName() string { return "changelogs" }
+
+// schema as of version 3
+type v3BuildMetadata struct {
+	ID               uint `gorm:"primaryKey"`
+	GeneratorVersion string
+	SchemaVersion    int
+	Mode             string
+	StartedAt        time.Time
+	FinishedAt       time.Time
+	Sources          string
+	Warnings         int
+	Errors           int
+	PageRevisions    []v3BuildPageRevision `gorm:"foreignKey:BuildMetadataID"`
+	RowCounts        []v3BuildRowCount     `gorm:"foreignKey:BuildMetadataID"`
+}
+
+func (v3BuildMetadata) TableName() string { return "build_metadata" }
+
+type v3BuildPageRevision struct {
+	ID              uint `gorm:"primaryKey"`
+	BuildMetadataID uint
+	URL             string
+	RevisionID      int64
+}
+
+func (v3BuildPageRevision) TableName() string { return "build_page_revisions" }
+
+type v3BuildRowCount struct {
+	ID              uint `gorm:"primaryKey"`
+	BuildMetadataID uint
+	Name            string
+	RowCount        int64
+}
+
+func (v3BuildRowCount) TableName() string { return "build_row_counts" }
+
+// schema as of version 4
+type v4Device struct {
+	ID             uint   `gorm:"primaryKey"`
+	Codename       string `gorm:"unique"`
+	HardwareFamily string `gorm:"index:idx_devices_hardware"`
+	HardwarePrefix string `gorm:"index:idx_devices_hardware"`
+	HardwareMajor  int    `gorm:"index:idx_devices_hardware"`
+	HardwareMinor  int    `gorm:"index:idx_devices_hardware"`
+}
+
+func (v4Device) TableName() string { return "devices" }
+
+// v4BackfillHardware fills the hardware columns of the devices created
+// before version 4.
+func v4BackfillHardware(tx *gorm.DB) error {
+	var devices []v4Device
+	if err := tx.Select("id", "codename").Find(&devices).Error; err != nil {
+		return err
+	}
+	for _, d := range devices {
+		hw, err := version.HardwareIdentifierFromString(d.Codename)
+		if err != nil {
+			log.Warnf("[Migrate] device %s: %s", d.Codename, err.Error())
+			continue
+		}
+		err = tx.Model(&v4Device{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+			"hardware_family": string(hw.Family()),
+			"hardware_prefix": hw.Prefix,
+			"hardware_major":  hw.Major,
+			"hardware_minor":  hw.Minor,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schema as of version 5
+type v5OperatingSystem struct {
+	ID      uint              `gorm:"primaryKey"`
+	Version version.OSVersion `gorm:"index"`
+}
+
+func (v5OperatingSystem) TableName() string { return "operating_systems" }
+
+// schema as of version 6
+type v6OperatingSystem struct {
+	ID            uint `gorm:"primaryKey"`
+	DarwinVersion *version.OSVersion
+}
+
+func (v6OperatingSystem) TableName() string { return "operating_systems" }
+
+// schema as of version 7
+type v7OperatingSystem struct {
+	ID          uint `gorm:"primaryKey"`
+	ReleaseDate *time.Time
+}
+
+func (v7OperatingSystem) TableName() string { return "operating_systems" }
+
+type v7DeviceTimeline struct {
+	ID             uint   `gorm:"primaryKey"`
+	Codename       string `gorm:"uniqueIndex:idx_device_timelines_device"`
+	Family         string `gorm:"uniqueIndex:idx_device_timelines_device"`
+	ShippingOS     version.OSVersion
+	ShippingDate   *time.Time
+	LastMajor      int
+	LastUpdate     version.OSVersion
+	LastUpdateDate *time.Time
+	SupportYears   *float64
+	DroppedBy      *int
+}
+
+func (v7DeviceTimeline) TableName() string { return "device_timelines" }
+
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "processors, devices, operating systems and build numbers",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v1AppleProcessor{}, &v1Device{}, &v1OperatingSystem{}, &v1BuildNumber{})
+		},
+	},
+	{
+		Version:     2,
+		Description: "changelog of sync runs",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v2Changelog{})
+		},
+	},
+	{
+		Version:     3,
+		Description: "build metadata of each run",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v3BuildMetadata{}, &v3BuildPageRevision{}, &v3BuildRowCount{})
+		},
+	},
+	{
+		Version:     4,
+		Description: "structured hardware identifier columns on devices",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&v4Device{}); err != nil {
+				return err
+			}
+			return v4BackfillHardware(tx)
+		},
+	},
+	{
+		Version:     5,
+		Description: "single sortable version column on operating systems",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&v5OperatingSystem{}); err != nil {
+				return err
+			}
+			// same encoding as version.OSVersion.Value
+			return tx.Exec("UPDATE operating_systems SET version = version_x * 1000000 + version_y * 1000 + version_z").Error
+		},
+	},
+	{
+		Version:     6,
+		Description: "darwin kernel version of operating systems",
+		Up: func(tx *gorm.DB) error {
+			// left NULL: the next run fills it
+			return tx.AutoMigrate(&v6OperatingSystem{})
+		},
+	},
+	{
+		Version:     7,
+		Description: "release dates of operating systems and device support timelines",
+		Up: func(tx *gorm.DB) error {
+			// both filled by the next run
+			return tx.AutoMigrate(&v7OperatingSystem{}, &v7DeviceTimeline{})
+		},
+	},
+}
+
+// SchemaVersion is the schema version produced by this generator.
+var SchemaVersion = migrations[len(migrations)-1].Version
+
+// DBSchemaVersion returns the schema version of db, 0 for a DB created
+// before schema versioning was introduced (or an empty one).
+func DBSchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&SchemaInfo{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Model(&SchemaInfo{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// Migrate applies, in order and each in its own transaction, all the
+// migrations db has not seen yet. Views are derived data: they are dropped
+// before and recreated after the migrations, so that migrations are free to
+// rebuild the tables they depend on.
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&SchemaInfo{}); err != nil {
+		return err
+	}
+	current, err := DBSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > SchemaVersion {
+		return fmt.Errorf("db schema version %d is newer than the one supported by this generator (%d)", current, SchemaVersion)
+	}
+	if current == SchemaVersion {
+		return nil
+	}
+	if err := dropViews(db); err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		log.Infof("[Migrate] schema %d -> %d: %s", m.Version-1, m.Version, m.Description)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaInfo{Version: m.Version, Description: m.Description, Breaking: m.Breaking, AppliedAt: time.Now().UTC()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+	}
+	return createViews(db)
+}
+
+// SchemaCompatible tells whether a consumer written against schema version
+// expected can read a DB whose schema_info content is applied: the DB must
+// be at least as recent, and no breaking migration may have been applied
+// after expected. Breaking flags are read from the DB rather than from
+// this binary, so that consumers built before a migration existed still
+// get the right answer. It returns the schema version of the DB.
+func SchemaCompatible(applied []SchemaInfo, expected int) (int, error) {
+	actual := 0
+	for _, m := range applied {
+		if m.Version > actual {
+			actual = m.Version
+		}
+	}
+	if actual < expected {
+		return actual, fmt.Errorf("db schema version %d is older than the expected version %d", actual, expected)
+	}
+	for _, m := range applied {
+		if m.Version > expected && m.Breaking {
+			return actual, fmt.Errorf("db schema version %d contains breaking migration %d (%s) over the expected version %d", actual, m.Version, m.Description, expected)
+		}
+	}
+	return actual, nil
+}
+
+// CheckSchema opens the DB file at dbfile read-only and verifies that a
+// consumer expecting schema version expected can use it. It returns the
+// schema version of the file.
+func CheckSchema(dbfile string, expected int) (int, error) {
+	db, err := OpenReadOnly(dbfile)
+	if err != nil {
+		return 0, err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	return CheckSchemaDB(db, expected)
+}
+
+// CheckSchemaDB is CheckSchema on an already open DB.
+func CheckSchemaDB(db *gorm.DB, expected int) (int, error) {
+	var applied []SchemaInfo
+	if db.Migrator().HasTable(&SchemaInfo{}) {
+		if err := db.Find(&applied).Error; err != nil {
+			return 0, err
+		}
+	}
+	return SchemaCompatible(applied, expected)
+}
@@ -0,0 +1,550 @@
+package dbtools
+
+import (
+	"appledata/Packages/version"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+const (
+	EntityProcessor = "processor"
+	EntityOSVersion = "os_version"
+	EntityBuild     = "build"
+	EntityDevice    = "device"
+	EntityDeviceOS  = "device_os"
+)
+
+// Changelog records every change applied to the DB by a sync run.
+type Changelog struct {
+	ID     uint      `gorm:"primaryKey"`
+	RunAt  time.Time `gorm:"index"`
+	Action string
+	Entity string
+	Key    string
+	Detail string
+}
+
+// Change is a single insert/update/delete of an entity, identified by its
+// natural key (processor code, version string, build number, hardware
+// string, or "hardware string@version" for device_os rows).
+type Change struct {
+	Action string
+	Entity string
+	Key    string
+	Detail string
+	// Initial is set on the changes of a sync run whose destination had
+	// no OS versions, builds or devices yet
+	Initial bool
+}
+
+// markInitial flags changes as an initial import when existing, the
+// destination content they were computed against, is empty.
+func markInitial(existing Snapshot, changes []Change) {
+	if len(existing.Versions) > 0 || len(existing.Builds) > 0 || len(existing.Devices) > 0 {
+		return
+	}
+	for i := range changes {
+		changes[i].Initial = true
+	}
+}
+
+func (c Change) String() string {
+	if c.Detail == "" {
+		return fmt.Sprintf("%s %s %s", c.Action, c.Entity, c.Key)
+	}
+	return fmt.Sprintf("%s %s %s (%s)", c.Action, c.Entity, c.Key, c.Detail)
+}
+
+type SnapshotDevice struct {
+	Modelname string
+	Cpu       string // processor code, empty when unknown
+}
+
+// Snapshot is the content of a DB keyed by natural keys, so that two DBs
+// can be compared regardless of their row ids.
+type Snapshot struct {
+	Processors map[string]string         // code -> label
+	Versions   map[string]bool           // "x.y.z"
+	Darwin     map[string]string         // "x.y.z" -> darwin "x.y.z", when known
+	Released   map[string]string         // "x.y.z" -> "yyyy-mm-dd", when known
+	Builds     map[string]string         // build number -> "x.y.z"
+	Devices    map[string]SnapshotDevice // codename -> device
+	DeviceOS   map[string]bool           // "codename@x.y.z"
+}
+
+func deviceOSKey(codename string, osver string) string {
+	return codename + "@" + osver
+}
+
+func osKey(opsys OperatingSystem) string {
+	return fmt.Sprintf("%d.%d.%d", opsys.VersionX, opsys.VersionY, opsys.VersionZ)
+}
+
+// LoadSnapshot reads the whole content of db.
+func LoadSnapshot(db *gorm.DB) (Snapshot, error) {
+	snap := Snapshot{
+		Processors: map[string]string{},
+		Versions:   map[string]bool{},
+		Darwin:     map[string]string{},
+		Released:   map[string]string{},
+		Builds:     map[string]string{},
+		Devices:    map[string]SnapshotDevice{},
+		DeviceOS:   map[string]bool{},
+	}
+	var processors []AppleProcessor
+	if err := db.Find(&processors).Error; err != nil {
+		return snap, err
+	}
+	cpuCodes := map[uint]string{}
+	for _, p := range processors {
+		snap.Processors[p.Code] = p.Label
+		cpuCodes[p.ID] = p.Code
+	}
+	var oses []OperatingSystem
+	if err := db.Preload("BuildNumbers").Find(&oses).Error; err != nil {
+		return snap, err
+	}
+	for _, opsys := range oses {
+		snap.Versions[osKey(opsys)] = true
+		if opsys.DarwinVersion != nil {
+			snap.Darwin[osKey(opsys)] = opsys.DarwinVersion.String()
+		}
+		if opsys.ReleaseDate != nil {
+			snap.Released[osKey(opsys)] = opsys.ReleaseDate.UTC().Format(version.ReleaseDateLayout)
+		}
+		for _, bn := range opsys.BuildNumbers {
+			snap.Builds[bn.BuildNumber] = osKey(opsys)
+		}
+	}
+	var devices []Device
+	if err := db.Preload("OperatingSystems").Find(&devices).Error; err != nil {
+		return snap, err
+	}
+	for _, d := range devices {
+		snap.Devices[d.Codename] = SnapshotDevice{Modelname: d.Modelname, Cpu: cpuCodes[uint(d.CpuID)]}
+		for _, opsys := range d.OperatingSystems {
+			snap.DeviceOS[deviceOSKey(d.Codename, osKey(*opsys))] = true
+		}
+	}
+	return snap, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedVersionKeys returns the "x.y.z" keys of m in version order.
+func sortedVersionKeys[V any](m map[string]V) []string {
+	keys := sortedKeys(m)
+	version.SortVersionStrings(keys)
+	return keys
+}
+
+// sortedDeviceOSKeys returns the "codename@x.y.z" keys of m by codename,
+// then in version order.
+func sortedDeviceOSKeys(m map[string]bool) []string {
+	keys := sortedKeys(m)
+	sort.SliceStable(keys, func(i, j int) bool {
+		ci, vi, _ := strings.Cut(keys[i], "@")
+		cj, vj, _ := strings.Cut(keys[j], "@")
+		if ci != cj {
+			return ci < cj
+		}
+		oi, _ := version.OSVersionFromString(vi)
+		oj, _ := version.OSVersionFromString(vj)
+		return oi.Lt(oj)
+	})
+	return keys
+}
+
+// DiffSnapshots lists the changes turning old into new. Changes are sorted
+// so that applying them in order never references a missing row: inserts
+// and updates go parents first, deletes go children first.
+func DiffSnapshots(old Snapshot, new Snapshot) []Change {
+	var upserts, deletes []Change
+
+	for _, code := range sortedKeys(new.Processors) {
+		label := new.Processors[code]
+		if oldLabel, exists := old.Processors[code]; !exists {
+			upserts = append(upserts, Change{Action: ChangeInsert, Entity: EntityProcessor, Key: code, Detail: label})
+		} else if oldLabel != label {
+			upserts = append(upserts, Change{Action: ChangeUpdate, Entity: EntityProcessor, Key: code, Detail: fmt.Sprintf("label: %q -> %q", oldLabel, label)})
+		}
+	}
+	for _, ver := range sortedVersionKeys(new.Versions) {
+		var details []string
+		if !old.Versions[ver] {
+			if darwin := new.Darwin[ver]; darwin != "" {
+				details = append(details, fmt.Sprintf("darwin: %q", darwin))
+			}
+			if released := new.Released[ver]; released != "" {
+				details = append(details, fmt.Sprintf("released: %q", released))
+			}
+			upserts = append(upserts, Change{Action: ChangeInsert, Entity: EntityOSVersion, Key: ver, Detail: strings.Join(details, "; ")})
+			continue
+		}
+		if old.Darwin[ver] != new.Darwin[ver] {
+			details = append(details, fmt.Sprintf("darwin: %q -> %q", old.Darwin[ver], new.Darwin[ver]))
+		}
+		if old.Released[ver] != new.Released[ver] {
+			details = append(details, fmt.Sprintf("released: %q -> %q", old.Released[ver], new.Released[ver]))
+		}
+		if len(details) > 0 {
+			upserts = append(upserts, Change{Action: ChangeUpdate, Entity: EntityOSVersion, Key: ver, Detail: strings.Join(details, "; ")})
+		}
+	}
+	for _, bn := range sortedKeys(new.Builds) {
+		ver := new.Builds[bn]
+		if oldVer, exists := old.Builds[bn]; !exists {
+			upserts = append(upserts, Change{Action: ChangeInsert, Entity: EntityBuild, Key: bn, Detail: ver})
+		} else if oldVer != ver {
+			upserts = append(upserts, Change{Action: ChangeUpdate, Entity: EntityBuild, Key: bn, Detail: fmt.Sprintf("version: %s -> %s", oldVer, ver)})
+		}
+	}
+	for _, codename := range sortedKeys(new.Devices) {
+		dev := new.Devices[codename]
+		oldDev, exists := old.Devices[codename]
+		if !exists {
+			upserts = append(upserts, Change{Action: ChangeInsert, Entity: EntityDevice, Key: codename, Detail: fmt.Sprintf("modelname: %q; cpu: %q", dev.Modelname, dev.Cpu)})
+			continue
+		}
+		var details []string
+		if oldDev.Modelname != dev.Modelname {
+			details = append(details, fmt.Sprintf("modelname: %q -> %q", oldDev.Modelname, dev.Modelname))
+		}
+		if oldDev.Cpu != dev.Cpu {
+			details = append(details, fmt.Sprintf("cpu: %q -> %q", oldDev.Cpu, dev.Cpu))
+		}
+		if len(details) > 0 {
+			upserts = append(upserts, Change{Action: ChangeUpdate, Entity: EntityDevice, Key: codename, Detail: strings.Join(details, "; ")})
+		}
+	}
+	for _, key := range sortedDeviceOSKeys(new.DeviceOS) {
+		if !old.DeviceOS[key] {
+			upserts = append(upserts, Change{Action: ChangeInsert, Entity: EntityDeviceOS, Key: key})
+		}
+	}
+
+	for _, key := range sortedDeviceOSKeys(old.DeviceOS) {
+		if !new.DeviceOS[key] {
+			deletes = append(deletes, Change{Action: ChangeDelete, Entity: EntityDeviceOS, Key: key})
+		}
+	}
+	for _, codename := range sortedKeys(old.Devices) {
+		if _, exists := new.Devices[codename]; !exists {
+			deletes = append(deletes, Change{Action: ChangeDelete, Entity: EntityDevice, Key: codename, Detail: old.Devices[codename].Modelname})
+		}
+	}
+	for _, bn := range sortedKeys(old.Builds) {
+		if _, exists := new.Builds[bn]; !exists {
+			deletes = append(deletes, Change{Action: ChangeDelete, Entity: EntityBuild, Key: bn, Detail: old.Builds[bn]})
+		}
+	}
+	for _, ver := range sortedVersionKeys(old.Versions) {
+		if !new.Versions[ver] {
+			deletes = append(deletes, Change{Action: ChangeDelete, Entity: EntityOSVersion, Key: ver})
+		}
+	}
+	for _, code := range sortedKeys(old.Processors) {
+		if _, exists := new.Processors[code]; !exists {
+			deletes = append(deletes, Change{Action: ChangeDelete, Entity: EntityProcessor, Key: code, Detail: old.Processors[code]})
+		}
+	}
+	return append(upserts, deletes...)
+}
+
+func findOS(tx *gorm.DB, key string) (OperatingSystem, error) {
+	var opsys OperatingSystem
+	var x, y, z int
+	if _, err := fmt.Sscanf(key, "%d.%d.%d", &x, &y, &z); err != nil {
+		return opsys, fmt.Errorf("bad version key %q: %w", key, err)
+	}
+	err := tx.Where("version_x = ? AND version_y = ? AND version_z = ?", x, y, z).First(&opsys).Error
+	return opsys, err
+}
+
+func findDevice(tx *gorm.DB, codename string) (Device, error) {
+	var device Device
+	err := tx.Where("codename = ?", codename).First(&device).Error
+	return device, err
+}
+
+// snapshotRelease returns the release key of new, without its builds.
+func snapshotRelease(new Snapshot, key string) (version.IOSVersion, error) {
+	var rel version.IOSVersion
+	if err := rel.Version.UnmarshalText([]byte(key)); err != nil {
+		return rel, err
+	}
+	if s := new.Darwin[key]; s != "" {
+		var darwin version.OSVersion
+		if err := darwin.UnmarshalText([]byte(s)); err != nil {
+			return rel, err
+		}
+		rel.Darwin = &darwin
+	}
+	if s := new.Released[key]; s != "" {
+		released, err := time.Parse(version.ReleaseDateLayout, s)
+		if err != nil {
+			return rel, err
+		}
+		rel.Released = &released
+	}
+	return rel, nil
+}
+
+func cpuID(tx *gorm.DB, code string) (int, error) {
+	if code == "" {
+		return 0, nil
+	}
+	var cpu AppleProcessor
+	if err := tx.Where("code = ?", code).First(&cpu).Error; err != nil {
+		return 0, err
+	}
+	return int(cpu.ID), nil
+}
+
+func applyChange(tx *gorm.DB, new Snapshot, c Change) error {
+	switch c.Entity {
+	case EntityProcessor:
+		switch c.Action {
+		case ChangeInsert:
+			return tx.Create(&AppleProcessor{Code: c.Key, Label: new.Processors[c.Key]}).Error
+		case ChangeUpdate:
+			return tx.Model(&AppleProcessor{}).Where("code = ?", c.Key).Update("label", new.Processors[c.Key]).Error
+		case ChangeDelete:
+			return tx.Where("code = ?", c.Key).Delete(&AppleProcessor{}).Error
+		}
+	case EntityOSVersion:
+		switch c.Action {
+		case ChangeInsert, ChangeUpdate:
+			rel, err := snapshotRelease(new, c.Key)
+			if err != nil {
+				return err
+			}
+			row := newOperatingSystem(rel)
+			if c.Action == ChangeInsert {
+				return tx.Create(&row).Error
+			}
+			opsys, err := findOS(tx, c.Key)
+			if err != nil {
+				return err
+			}
+			// through a map, so that unknown values are set to NULL
+			updates := map[string]interface{}{"darwin_version": nil, "release_date": nil}
+			if row.DarwinVersion != nil {
+				updates["darwin_version"] = *row.DarwinVersion
+			}
+			if row.ReleaseDate != nil {
+				updates["release_date"] = *row.ReleaseDate
+			}
+			return tx.Model(&opsys).Updates(updates).Error
+		case ChangeDelete:
+			opsys, err := findOS(tx, c.Key)
+			if err != nil {
+				return err
+			}
+			return tx.Delete(&opsys).Error
+		}
+	case EntityBuild:
+		switch c.Action {
+		case ChangeInsert, ChangeUpdate:
+			opsys, err := findOS(tx, new.Builds[c.Key])
+			if err != nil {
+				return err
+			}
+			if c.Action == ChangeInsert {
+				return tx.Create(&BuildNumber{OperatingSystemRef: opsys.ID, BuildNumber: c.Key}).Error
+			}
+			return tx.Model(&BuildNumber{}).Where("build_number = ?", c.Key).Update("operating_system_ref", opsys.ID).Error
+		case ChangeDelete:
+			return tx.Where("build_number = ?", c.Key).Delete(&BuildNumber{}).Error
+		}
+	case EntityDevice:
+		switch c.Action {
+		case ChangeInsert, ChangeUpdate:
+			dev := new.Devices[c.Key]
+			cpu, err := cpuID(tx, dev.Cpu)
+			if err != nil {
+				return err
+			}
+			if c.Action == ChangeInsert {
+				row := newDevice(dev.Modelname, c.Key)
+				row.CpuID = cpu
+				return tx.Create(&row).Error
+			}
+			return tx.Model(&Device{}).Where("codename = ?", c.Key).
+				Updates(map[string]interface{}{"modelname": dev.Modelname, "cpu_id": cpu}).Error
+		case ChangeDelete:
+			return tx.Where("codename = ?", c.Key).Delete(&Device{}).Error
+		}
+	case EntityDeviceOS:
+		parts := strings.SplitN(c.Key, "@", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("bad device_os key %q", c.Key)
+		}
+		device, err := findDevice(tx, parts[0])
+		if err != nil {
+			return err
+		}
+		opsys, err := findOS(tx, parts[1])
+		if err != nil {
+			return err
+		}
+		switch c.Action {
+		case ChangeInsert:
+			return tx.Model(&device).Association("OperatingSystems").Append(&opsys)
+		case ChangeDelete:
+			return tx.Model(&device).Association("OperatingSystems").Delete(&opsys)
+		}
+	}
+	return fmt.Errorf("unsupported change: %s", c.String())
+}
+
+// ApplyChanges applies changes (as computed by DiffSnapshots against new)
+// to db in a single transaction, logging each of them to the changelog
+// table with the given run time.
+func ApplyChanges(db *gorm.DB, new Snapshot, changes []Change, runAt time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, c := range changes {
+			if err := applyChange(tx, new, c); err != nil {
+				return fmt.Errorf("%s: %w", c.String(), err)
+			}
+			entry := Changelog{RunAt: runAt, Action: c.Action, Entity: c.Entity, Key: c.Key, Detail: c.Detail}
+			if err := tx.Create(&entry).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Sync is the incremental counterpart of Flush: instead of replacing the
+// content of the target with the scraped data, it applies the differences
+// between the two and records them in the changelog table along with
+// meta. A SQLite target is updated through a copy atomically moved into
+// place, a server target in a single transaction.
+func (s *SQLStore) Sync(meta BuildMetadata) ([]Change, error) {
+	fresh, err := s.scraped()
+	if err != nil {
+		s.Abort()
+		return nil, err
+	}
+	if s.dialect != DialectSQLite {
+		changes, err := syncInto(s.dest, fresh, meta)
+		if err != nil {
+			s.Abort()
+			return nil, err
+		}
+		log.Infof("[Sync] %d changes applied to %s", len(changes), s.Target())
+		return changes, s.finish()
+	}
+
+	tmpfile, err := os.CreateTemp(path.Dir(s.dsn), path.Base(s.dsn)+".*.tmp")
+	if err != nil {
+		s.Abort()
+		return nil, err
+	}
+	tmpfile.Close()
+	syncPath := tmpfile.Name()
+	// from here on the scraped data is in memory: the target copy becomes
+	// the temporary db that Abort cleans up
+	s.close()
+	os.Remove(s.tmpPath)
+	s.tmpPath = syncPath
+
+	if _, err := os.Stat(s.dsn); err == nil {
+		if err := copyFile(s.dsn, syncPath); err != nil {
+			s.Abort()
+			return nil, fmt.Errorf("unable to copy %s: %w", s.dsn, err)
+		}
+	} else {
+		log.Infof("[Sync] no existing database at %s, every row will be inserted", s.dsn)
+	}
+	s.conn, err = s.opts.open(DialectSQLite, syncPath)
+	if err != nil {
+		s.Abort()
+		return nil, err
+	}
+	changes, err := syncInto(s.conn, fresh, meta)
+	if err != nil {
+		s.Abort()
+		return nil, err
+	}
+	if err := s.close(); err != nil {
+		s.Abort()
+		return nil, err
+	}
+	if err := os.Rename(syncPath, s.dsn); err != nil {
+		s.Abort()
+		return nil, fmt.Errorf("unable to move %s to %s: %w", syncPath, s.dsn, err)
+	}
+	log.Infof("[Sync] %d changes applied to %s", len(changes), s.dsn)
+	s.tmpPath = ""
+	return changes, nil
+}
+
+// syncInto migrates db, applies to it the changes turning its content into
+// fresh and records them along with meta.
+func syncInto(db *gorm.DB, fresh Snapshot, meta BuildMetadata) ([]Change, error) {
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("schema migration failed: %w", err)
+	}
+	existing, err := LoadSnapshot(db)
+	if err != nil {
+		return nil, err
+	}
+	changes := DiffSnapshots(existing, fresh)
+	markInitial(existing, changes)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := ApplyChanges(tx, fresh, changes, time.Now().UTC()); err != nil {
+			return err
+		}
+		if err := refreshTimelines(tx); err != nil {
+			return fmt.Errorf("unable to compute device timelines: %w", err)
+		}
+		if err := writeMetadata(tx, meta); err != nil {
+			return fmt.Errorf("unable to write build metadata: %w", err)
+		}
+		if err := DBCheck(tx); err != nil {
+			return fmt.Errorf("integrity check failed: %w", err)
+		}
+		return nil
+	})
+	return changes, err
+}
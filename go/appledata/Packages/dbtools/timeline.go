@@ -0,0 +1,120 @@
+package dbtools
+
+import (
+	"appledata/Packages/version"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeviceTimeline is the support span of a device on an OS family. The
+// table is derived data: it is recomputed from the releases each device
+// runs at the end of every run.
+type DeviceTimeline struct {
+	ID       uint   `gorm:"primaryKey"`
+	Codename string `gorm:"uniqueIndex:idx_device_timelines_device"`
+	Family   string `gorm:"uniqueIndex:idx_device_timelines_device"`
+	// ShippingOS is the first release the device runs
+	ShippingOS   version.OSVersion
+	ShippingDate *time.Time
+	// LastMajor is the latest major version the device runs
+	LastMajor int
+	// LastUpdate is the latest release the device runs: its last security
+	// update once it has been dropped
+	LastUpdate     version.OSVersion
+	LastUpdateDate *time.Time
+	// SupportYears is the time between ShippingDate and LastUpdateDate, in
+	// years, NULL when either is unknown
+	SupportYears *float64
+	// DroppedBy is the first major version the device does not run, NULL
+	// while it runs the latest major version
+	DroppedBy *int
+}
+
+// daysPerYear is the average length of a Gregorian year
+const daysPerYear = 365.2425
+
+// computeTimelines derives the timeline of every device of db, ordered by
+// family and codename.
+func computeTimelines(db *gorm.DB) ([]DeviceTimeline, error) {
+	var oses []OperatingSystem
+	if err := db.Find(&oses).Error; err != nil {
+		return nil, err
+	}
+	// latest major version of each family
+	latestMajor := map[string]int{}
+	majors := map[string][]int{}
+	for _, o := range oses {
+		if _, exists := latestMajor[o.Name]; !exists || o.VersionX > latestMajor[o.Name] {
+			latestMajor[o.Name] = o.VersionX
+		}
+		majors[o.Name] = append(majors[o.Name], o.VersionX)
+	}
+	for family := range majors {
+		sort.Ints(majors[family])
+	}
+	var devices []Device
+	if err := db.Preload("OperatingSystems").Order("codename").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	var timelines []DeviceTimeline
+	for _, d := range devices {
+		byFamily := map[string][]*OperatingSystem{}
+		for _, o := range d.OperatingSystems {
+			byFamily[o.Name] = append(byFamily[o.Name], o)
+		}
+		for _, family := range sortedKeys(byFamily) {
+			releases := byFamily[family]
+			sort.Slice(releases, func(i, j int) bool {
+				return osVersion(*releases[i]).Lt(osVersion(*releases[j]))
+			})
+			first, last := releases[0], releases[len(releases)-1]
+			tl := DeviceTimeline{
+				Codename:       d.Codename,
+				Family:         family,
+				ShippingOS:     osVersion(*first),
+				ShippingDate:   first.ReleaseDate,
+				LastMajor:      last.VersionX,
+				LastUpdate:     osVersion(*last),
+				LastUpdateDate: last.ReleaseDate,
+			}
+			if tl.ShippingDate != nil && tl.LastUpdateDate != nil {
+				years := math.Round(tl.LastUpdateDate.Sub(*tl.ShippingDate).Hours()/24/daysPerYear*100) / 100
+				tl.SupportYears = &years
+			}
+			if tl.LastMajor < latestMajor[family] {
+				for _, major := range majors[family] {
+					if major > tl.LastMajor {
+						dropped := major
+						tl.DroppedBy = &dropped
+						break
+					}
+				}
+			}
+			timelines = append(timelines, tl)
+		}
+	}
+	return timelines, nil
+}
+
+func osVersion(o OperatingSystem) version.OSVersion {
+	return version.OSVersion{X: o.VersionX, Y: o.VersionY, Z: o.VersionZ}
+}
+
+// refreshTimelines replaces the content of the device_timelines table of db
+// with the timelines derived from its content.
+func refreshTimelines(db *gorm.DB) error {
+	timelines, err := computeTimelines(db)
+	if err != nil {
+		return err
+	}
+	if err := db.Where("1 = 1").Delete(&DeviceTimeline{}).Error; err != nil {
+		return err
+	}
+	if len(timelines) == 0 {
+		return nil
+	}
+	return db.CreateInBatches(&timelines, 100).Error
+}
@@ -0,0 +1,301 @@
+// Package diff compares the content of two generated DBs, e.g. two weekly
+// releases, and reports the added, removed and modified entities in text,
+// JSON or markdown for release notes.
+package diff
+
+import (
+	"appledata/Packages/dbtools"
+	"appledata/Packages/output"
+	"appledata/Packages/version"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	FormatText     = "text"
+	FormatJSON     = output.FormatJSON
+	FormatMarkdown = "markdown"
+)
+
+var Formats = []string{FormatText, FormatJSON, FormatMarkdown}
+
+// sections lists the compared entities in report order, with their titles
+var sections = []struct {
+	entity string
+	title  string
+}{
+	{dbtools.EntityProcessor, "Processors"},
+	{dbtools.EntityOSVersion, "OS versions"},
+	{dbtools.EntityBuild, "Builds"},
+	{dbtools.EntityDevice, "Devices"},
+	{dbtools.EntityDeviceOS, "Device/OS associations"},
+}
+
+// Side describes one of the compared DBs.
+type Side struct {
+	Path string `json:"path"`
+	// Generator and GeneratedAt come from the latest build metadata, empty
+	// on DBs without any
+	Generator   string     `json:"generator,omitempty"`
+	GeneratedAt *time.Time `json:"generated_at,omitempty"`
+}
+
+func (s Side) String() string {
+	if s.GeneratedAt == nil {
+		return s.Path
+	}
+	if s.Generator == "" {
+		return fmt.Sprintf("%s (%s)", s.Path, s.GeneratedAt.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s (generator %s, %s)", s.Path, s.Generator, s.GeneratedAt.Format(time.RFC3339))
+}
+
+// Entry is a single changed entity, keyed as in dbtools.Change: processor
+// code, version, build number, hardware string or
+// "hardware string@version" for associations.
+type Entry struct {
+	Key    string `json:"key"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Section holds the changes of a single entity.
+type Section struct {
+	Entity   string  `json:"entity"`
+	Title    string  `json:"title"`
+	Added    []Entry `json:"added"`
+	Removed  []Entry `json:"removed"`
+	Modified []Entry `json:"modified"`
+}
+
+func (s Section) Empty() bool {
+	return len(s.Added) == 0 && len(s.Removed) == 0 && len(s.Modified) == 0
+}
+
+// Report lists the changes turning Old into New, one section per entity,
+// in the order of sections.
+type Report struct {
+	Old      Side      `json:"old"`
+	New      Side      `json:"new"`
+	Sections []Section `json:"sections"`
+}
+
+// Empty reports whether both DBs have the same content.
+func (r Report) Empty() bool {
+	for _, s := range r.Sections {
+		if !s.Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare reports the changes turning old into new.
+func Compare(old dbtools.Snapshot, new dbtools.Snapshot) Report {
+	return FromChanges(dbtools.DiffSnapshots(old, new))
+}
+
+// FromChanges groups changes, as computed by dbtools.DiffSnapshots, by
+// entity and action. Entries are sorted by key, OS versions in version
+// order.
+func FromChanges(changes []dbtools.Change) Report {
+	report := Report{}
+	index := map[string]int{}
+	for i, s := range sections {
+		report.Sections = append(report.Sections, Section{Entity: s.entity, Title: s.title, Added: []Entry{}, Removed: []Entry{}, Modified: []Entry{}})
+		index[s.entity] = i
+	}
+	for _, c := range changes {
+		i, known := index[c.Entity]
+		if !known {
+			continue
+		}
+		s := &report.Sections[i]
+		entry := Entry{Key: c.Key, Detail: c.Detail}
+		switch c.Action {
+		case dbtools.ChangeInsert:
+			s.Added = append(s.Added, entry)
+		case dbtools.ChangeDelete:
+			s.Removed = append(s.Removed, entry)
+		case dbtools.ChangeUpdate:
+			s.Modified = append(s.Modified, entry)
+		}
+	}
+	for i := range report.Sections {
+		s := report.Sections[i]
+		for _, entries := range [][]Entry{s.Added, s.Removed, s.Modified} {
+			if s.Entity == dbtools.EntityOSVersion {
+				sort.SliceStable(entries, func(a, b int) bool {
+					va, _ := version.OSVersionFromString(entries[a].Key)
+					vb, _ := version.OSVersionFromString(entries[b].Key)
+					return va.Lt(vb)
+				})
+			} else {
+				sort.SliceStable(entries, func(a, b int) bool { return entries[a].Key < entries[b].Key })
+			}
+		}
+	}
+	return report
+}
+
+func loadSide(dbfile string) (dbtools.Snapshot, Side, error) {
+	side := Side{Path: dbfile}
+	runs, err := dbtools.ReadMetadata(dbfile)
+	if err != nil {
+		return dbtools.Snapshot{}, side, err
+	}
+	if len(runs) > 0 {
+		side.Generator = runs[0].GeneratorVersion
+		generatedAt := runs[0].FinishedAt.UTC()
+		side.GeneratedAt = &generatedAt
+	}
+	db, err := dbtools.OpenReadOnly(dbfile)
+	if err != nil {
+		return dbtools.Snapshot{}, side, err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	snap, err := dbtools.LoadSnapshot(db)
+	return snap, side, err
+}
+
+// Files compares the DB files at oldfile and newfile.
+func Files(oldfile string, newfile string) (Report, error) {
+	old, oldSide, err := loadSide(oldfile)
+	if err != nil {
+		return Report{}, fmt.Errorf("%s: %w", oldfile, err)
+	}
+	new, newSide, err := loadSide(newfile)
+	if err != nil {
+		return Report{}, fmt.Errorf("%s: %w", newfile, err)
+	}
+	report := Compare(old, new)
+	report.Old, report.New = oldSide, newSide
+	return report, nil
+}
+
+// Write writes r to w in format, one of Formats.
+func Write(w io.Writer, r Report, format string) error {
+	return output.Writers{
+		FormatText:     func(w io.Writer) error { return WriteText(w, r) },
+		FormatJSON:     func(w io.Writer) error { return WriteJSON(w, r) },
+		FormatMarkdown: func(w io.Writer) error { return WriteMarkdown(w, r) },
+	}.Write(w, format)
+}
+
+func WriteJSON(w io.Writer, r Report) error {
+	return output.JSON(w, r)
+}
+
+func (s Section) summary() string {
+	return fmt.Sprintf("%d added, %d removed, %d modified", len(s.Added), len(s.Removed), len(s.Modified))
+}
+
+func (e Entry) String() string {
+	if e.Detail == "" {
+		return e.Key
+	}
+	return fmt.Sprintf("%s (%s)", e.Key, e.Detail)
+}
+
+// byVersion groups association entries by version, so that the devices
+// gaining or losing a release are listed on a single line.
+func byVersion(entries []Entry) (versions []string, devices map[string][]string) {
+	devices = map[string][]string{}
+	for _, e := range entries {
+		at := strings.LastIndex(e.Key, "@")
+		if at < 0 {
+			continue
+		}
+		ver := e.Key[at+1:]
+		if _, seen := devices[ver]; !seen {
+			versions = append(versions, ver)
+		}
+		devices[ver] = append(devices[ver], e.Key[:at])
+	}
+	version.SortVersionStrings(versions)
+	return versions, devices
+}
+
+// lines formats entries of s one per entity, except associations which are
+// formatted one per version, their devices joined as the detail.
+func (s Section) lines(entries []Entry, format func(key string, detail string) string) []string {
+	var out []string
+	if s.Entity == dbtools.EntityDeviceOS {
+		versions, devices := byVersion(entries)
+		for _, ver := range versions {
+			out = append(out, format(ver, strings.Join(devices[ver], ", ")))
+		}
+		return out
+	}
+	for _, e := range entries {
+		out = append(out, format(e.Key, e.Detail))
+	}
+	return out
+}
+
+// WriteText writes r for a terminal: a summary line per entity followed
+// by its changes, marked + (added), - (removed) or ~ (modified).
+func WriteText(w io.Writer, r Report) error {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", r.Old.String(), r.New.String())
+	if r.Empty() {
+		_, err := fmt.Fprintln(w, "no differences")
+		return err
+	}
+	for _, s := range r.Sections {
+		if s.Empty() {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s\n", s.Title, s.summary())
+		for _, group := range []struct {
+			marker  string
+			entries []Entry
+		}{{"+", s.Added}, {"-", s.Removed}, {"~", s.Modified}} {
+			for _, line := range s.lines(group.entries, func(key string, detail string) string {
+				if s.Entity == dbtools.EntityDeviceOS {
+					return fmt.Sprintf("  %s %s: %s", group.marker, key, detail)
+				}
+				return fmt.Sprintf("  %s %s", group.marker, Entry{Key: key, Detail: detail}.String())
+			}) {
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+	return nil
+}
+
+// WriteMarkdown writes r as a markdown document, for release notes.
+func WriteMarkdown(w io.Writer, r Report) error {
+	fmt.Fprintf(w, "## Changes\n\nFrom `%s` to `%s`.\n", r.Old.String(), r.New.String())
+	if r.Empty() {
+		_, err := fmt.Fprintln(w, "\nNo differences.")
+		return err
+	}
+	for _, s := range r.Sections {
+		if s.Empty() {
+			continue
+		}
+		fmt.Fprintf(w, "\n### %s\n\n%s.\n", s.Title, s.summary())
+		for _, group := range []struct {
+			title   string
+			entries []Entry
+		}{{"Added", s.Added}, {"Removed", s.Removed}, {"Modified", s.Modified}} {
+			if len(group.entries) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "\n**%s**\n\n", group.title)
+			for _, line := range s.lines(group.entries, func(key string, detail string) string {
+				if detail == "" {
+					return fmt.Sprintf("- `%s`", key)
+				}
+				return fmt.Sprintf("- `%s`: %s", key, detail)
+			}) {
+				fmt.Fprintln(w, line)
+			}
+		}
+	}
+	return nil
+}
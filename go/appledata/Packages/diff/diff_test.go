@@ -0,0 +1,155 @@
+package diff
+
+import (
+	"appledata/Packages/dbtools"
+	"appledata/Packages/version"
+	"bytes"
+	"encoding/json"
+	"path"
+	"strings"
+	"testing"
+)
+
+func v(s string) version.OSVersion {
+	ver, _ := version.OSVersionFromString(s)
+	return ver
+}
+
+type release struct {
+	ver, build string
+}
+
+func writeDB(t *testing.T, name string, releases []release, devices map[string][2]string) string {
+	t.Helper()
+	dbfile := path.Join(t.TempDir(), name)
+	s, err := dbtools.NewSQLStore(dbfile, dbtools.Options{})
+	if err != nil {
+		t.Fatalf("NewSQLStore: %s", err.Error())
+	}
+	s.UpdateCPU("A16_Bionic", "A16 Bionic")
+	for _, rel := range releases {
+		bn, _ := version.BuildNumberFromString(rel.build)
+		s.AddIOSVersion(version.IOSVersion{Version: v(rel.ver), Builds: []version.BuildNumber{bn}})
+	}
+	for codename, span := range devices {
+		s.AddDevice("iPhone "+codename, codename, "Apple A16 Bionic", v(span[0]), v(span[1]))
+	}
+	if err := s.Flush(dbtools.BuildMetadata{Mode: "generate", GeneratorVersion: "test"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	return dbfile
+}
+
+func testReport(t *testing.T) Report {
+	oldfile := writeDB(t, "old.sqlite", []release{{"16.0", "20A362"}, {"17.0", "21A329"}},
+		map[string][2]string{"iPhone10,3": {"16.0", "16.0"}, "iPhone11,2": {"16.0", "17.0"}})
+	newfile := writeDB(t, "new.sqlite", []release{{"16.0", "20A362"}, {"17.0", "21A329"}, {"17.0.1", "21A340"}},
+		map[string][2]string{"iPhone11,2": {"16.0", "17.0.1"}, "iPhone15,4": {"17.0", "17.0.1"}})
+	report, err := Files(oldfile, newfile)
+	if err != nil {
+		t.Fatalf("Files: %s", err.Error())
+	}
+	return report
+}
+
+func keys(entries []Entry) string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Key)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestFiles(t *testing.T) {
+	r := testReport(t)
+	if r.Old.Generator != "test" || r.New.GeneratedAt == nil || !strings.HasSuffix(r.New.Path, "new.sqlite") {
+		t.Fatalf("Unexpected sides: %+v %+v", r.Old, r.New)
+	}
+	expected := map[string][3]string{
+		dbtools.EntityProcessor: {"", "", ""},
+		dbtools.EntityOSVersion: {"17.0.1", "", ""},
+		dbtools.EntityBuild:     {"21A340", "", ""},
+		dbtools.EntityDevice:    {"iPhone15,4", "iPhone10,3", ""},
+		dbtools.EntityDeviceOS:  {"iPhone11,2@17.0.1 iPhone15,4@17.0.0 iPhone15,4@17.0.1", "iPhone10,3@16.0.0", ""},
+	}
+	if len(r.Sections) != len(expected) {
+		t.Fatalf("Expected %d sections, got %+v", len(expected), r.Sections)
+	}
+	for _, s := range r.Sections {
+		got := [3]string{keys(s.Added), keys(s.Removed), keys(s.Modified)}
+		if got != expected[s.Entity] {
+			t.Fatalf("%s: expected %v, got %v", s.Entity, expected[s.Entity], got)
+		}
+	}
+	if r.Empty() {
+		t.Fatalf("The report should not be empty")
+	}
+	same, err := Files(r.New.Path, r.New.Path)
+	if err != nil || !same.Empty() {
+		t.Fatalf("A db should not differ from itself: %+v %v", same, err)
+	}
+	if _, err := Files(r.Old.Path, path.Join(t.TempDir(), "missing.sqlite")); err == nil {
+		t.Fatalf("A missing db should not compare")
+	}
+}
+
+func TestVersionOrder(t *testing.T) {
+	r := FromChanges([]dbtools.Change{
+		{Action: dbtools.ChangeInsert, Entity: dbtools.EntityOSVersion, Key: "17.10.0"},
+		{Action: dbtools.ChangeInsert, Entity: dbtools.EntityOSVersion, Key: "17.2.0"},
+		{Action: dbtools.ChangeInsert, Entity: dbtools.EntityDeviceOS, Key: "iPhone15,4@17.10.0"},
+		{Action: dbtools.ChangeInsert, Entity: dbtools.EntityDeviceOS, Key: "iPhone15,4@17.2.0"},
+	})
+	if added := keys(r.Sections[1].Added); added != "17.2.0 17.10.0" {
+		t.Fatalf("Expected versions in version order, got %s", added)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, r, FormatText); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.Contains(buf.String(), "  + 17.2.0: iPhone15,4\n  + 17.10.0: iPhone15,4\n") {
+		t.Fatalf("Expected associations in version order:\n%s", buf.String())
+	}
+}
+
+func TestWrite(t *testing.T) {
+	r := testReport(t)
+	var buf bytes.Buffer
+	if err := Write(&buf, r, FormatText); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, line := range []string{
+		"OS versions: 1 added, 0 removed, 0 modified",
+		"  + 21A340 (17.0.1)",
+		"  - iPhone10,3 (iPhone iPhone10,3)",
+		"  + 17.0.1: iPhone11,2, iPhone15,4",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Fatalf("Expected line %q in\n%s", line, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "Processors") {
+		t.Fatalf("Unchanged entities should be left out:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := Write(&buf, r, FormatMarkdown); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.Contains(buf.String(), "\n### Devices\n\n1 added, 1 removed, 0 modified.\n\n**Added**\n\n- `iPhone15,4`: ") {
+		t.Fatalf("Unexpected markdown:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := Write(&buf, r, FormatJSON); err != nil {
+		t.Fatalf(err.Error())
+	}
+	var back Report
+	if err := json.Unmarshal(buf.Bytes(), &back); err != nil || len(back.Sections) != 5 || keys(back.Sections[1].Added) != "17.0.1" {
+		t.Fatalf("Unexpected JSON report: %s %v", buf.String(), err)
+	}
+
+	if err := Write(&buf, r, "html"); err == nil {
+		t.Fatalf("Unknown formats should be rejected")
+	}
+}
@@ -0,0 +1,252 @@
+package export
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/version"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatJSONFlat = "json-flat"
+	FormatCSV      = "csv"
+	FormatYAML     = "yaml"
+	FormatYAMLFlat = "yaml-flat"
+)
+
+var Formats = []string{FormatJSON, FormatJSONFlat, FormatCSV, FormatYAML, FormatYAMLFlat}
+
+// nested representation: one document, devices embedding their processor
+// and the versions they support
+type nestedProcessor struct {
+	Code  string `json:"code" yaml:"code"`
+	Label string `json:"label" yaml:"label"`
+}
+type nestedRelease struct {
+	Family  string            `json:"family" yaml:"family"`
+	Version version.OSVersion `json:"version" yaml:"version"`
+	Builds  []string          `json:"builds" yaml:"builds"`
+}
+type nestedDevice struct {
+	Codename   string              `json:"codename" yaml:"codename"`
+	Modelname  string              `json:"modelname" yaml:"modelname"`
+	Cpu        *nestedProcessor    `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+	OSVersions []version.OSVersion `json:"os_versions" yaml:"os_versions"`
+}
+type nestedDataset struct {
+	Processors []nestedProcessor `json:"processors" yaml:"processors"`
+	OSVersions []nestedRelease   `json:"os_versions" yaml:"os_versions"`
+	Devices    []nestedDevice    `json:"devices" yaml:"devices"`
+}
+
+func nested(ds *dataset.Dataset) nestedDataset {
+	out := nestedDataset{
+		Processors: []nestedProcessor{},
+		OSVersions: []nestedRelease{},
+		Devices:    []nestedDevice{},
+	}
+	for _, p := range ds.Processors {
+		out.Processors = append(out.Processors, nestedProcessor{Code: p.Code, Label: p.Label})
+	}
+	for _, r := range ds.Releases {
+		builds := append([]string{}, r.Builds...)
+		out.OSVersions = append(out.OSVersions, nestedRelease{Family: r.Family, Version: r.Version, Builds: builds})
+	}
+	for _, d := range ds.Devices {
+		dev := nestedDevice{Codename: d.Codename, Modelname: d.Modelname, OSVersions: []version.OSVersion{}}
+		if d.Cpu != nil {
+			dev.Cpu = &nestedProcessor{Code: d.Cpu.Code, Label: d.Cpu.Label}
+		}
+		for _, r := range d.Releases {
+			dev.OSVersions = append(dev.OSVersions, r.Version)
+		}
+		out.Devices = append(out.Devices, dev)
+	}
+	return out
+}
+
+// Table is a flat, ordered representation of a DB table or view.
+type Table struct {
+	Name    string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Records returns the rows as column name -> value maps.
+func (t Table) Records() []map[string]interface{} {
+	records := []map[string]interface{}{}
+	for _, row := range t.Rows {
+		record := map[string]interface{}{}
+		for i, col := range t.Columns {
+			record[col] = row[i]
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// Tables returns the content of ds as one table per entity, associations
+// included, referencing each other by natural keys.
+func Tables(ds *dataset.Dataset) []Table {
+	processors := Table{Name: "processors", Columns: []string{"code", "label"}}
+	for _, p := range ds.Processors {
+		processors.Rows = append(processors.Rows, []interface{}{p.Code, p.Label})
+	}
+	osVersions := Table{Name: "os_versions", Columns: []string{"family", "version", "version_x", "version_y", "version_z"}}
+	builds := Table{Name: "builds", Columns: []string{"build", "family", "version"}}
+	for _, r := range ds.Releases {
+		osVersions.Rows = append(osVersions.Rows, []interface{}{r.Family, r.Version.String(), r.Version.X, r.Version.Y, r.Version.Z})
+		for _, b := range r.Builds {
+			builds.Rows = append(builds.Rows, []interface{}{b, r.Family, r.Version.String()})
+		}
+	}
+	devices := Table{Name: "devices", Columns: []string{"codename", "modelname", "cpu_code"}}
+	deviceOS := Table{Name: "device_os", Columns: []string{"codename", "family", "version"}}
+	for _, d := range ds.Devices {
+		cpu := ""
+		if d.Cpu != nil {
+			cpu = d.Cpu.Code
+		}
+		devices.Rows = append(devices.Rows, []interface{}{d.Codename, d.Modelname, cpu})
+		for _, r := range d.Releases {
+			deviceOS.Rows = append(deviceOS.Rows, []interface{}{d.Codename, r.Family, r.Version.String()})
+		}
+	}
+	return []Table{processors, osVersions, builds, devices, deviceOS}
+}
+
+var viewQueries = map[string]string{
+	"v_os_model": "SELECT * FROM v_os_model ORDER BY version_x, version_y, version_z, codename",
+	"v_os_build": "SELECT * FROM v_os_build ORDER BY version_x, version_y, version_z, build_number",
+}
+
+// ViewTables returns the content of the v_os_model and v_os_build views.
+func ViewTables(db *gorm.DB) ([]Table, error) {
+	var tables []Table
+	for _, name := range []string{"v_os_model", "v_os_build"} {
+		rows, err := db.Raw(viewQueries[name]).Rows()
+		if err != nil {
+			return nil, err
+		}
+		table := Table{Name: name}
+		table.Columns, err = rows.Columns()
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		for rows.Next() {
+			values := make([]interface{}, len(table.Columns))
+			pointers := make([]interface{}, len(table.Columns))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+			if err := rows.Scan(pointers...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			for i, v := range values {
+				if b, ok := v.([]byte); ok {
+					values[i] = string(b)
+				}
+			}
+			table.Rows = append(table.Rows, values)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func flat(tables []Table) map[string][]map[string]interface{} {
+	out := map[string][]map[string]interface{}{}
+	for _, t := range tables {
+		out[t.Name] = t.Records()
+	}
+	return out
+}
+
+// WriteJSON writes ds to w as a single nested JSON document.
+func WriteJSON(w io.Writer, ds *dataset.Dataset) error {
+	return writeJSON(w, nested(ds))
+}
+
+// WriteFlatJSON writes tables to w as a JSON object mapping each table
+// name to its list of rows.
+func WriteFlatJSON(w io.Writer, tables []Table) error {
+	return writeJSON(w, flat(tables))
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// WriteYAML writes ds to w as a single nested YAML document.
+func WriteYAML(w io.Writer, ds *dataset.Dataset) error {
+	return writeYAML(w, nested(ds))
+}
+
+// WriteFlatYAML writes tables to w as a YAML mapping each table name to
+// its list of rows.
+func WriteFlatYAML(w io.Writer, tables []Table) error {
+	return writeYAML(w, flat(tables))
+}
+
+func writeYAML(w io.Writer, v interface{}) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// WriteCSV writes each of tables to <dir>/<table name>.csv, with a header
+// row.
+func WriteCSV(dir string, tables []Table) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if err := writeCSVFile(path.Join(dir, t.Name+".csv"), t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCSVFile(filename string, t Table) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(f)
+	writer.Write(t.Columns)
+	for _, row := range t.Rows {
+		record := make([]string, len(row))
+		for i, v := range row {
+			if v != nil {
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/version"
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func testDataset() *dataset.Dataset {
+	a16 := &dataset.Processor{Code: "A16_Bionic", Label: "A16 Bionic"}
+	v17, _ := version.OSVersionFromString("17.0")
+	v171, _ := version.OSVersionFromString("17.1")
+	r17 := &dataset.Release{Family: "ios", Version: v17, Builds: []string{"21A329"}}
+	r171 := &dataset.Release{Family: "ios", Version: v171, Builds: []string{"21B74", "21B80"}}
+	return &dataset.Dataset{
+		Processors: []*dataset.Processor{a16},
+		Releases:   []*dataset.Release{r17, r171},
+		Devices: []*dataset.Device{
+			{Codename: "iPhone15,4", Modelname: "iPhone 15", Cpu: a16, Releases: []*dataset.Release{r17, r171}},
+			{Codename: "iPhone99,1", Modelname: "Unknown"},
+		},
+	}
+}
+
+func TestStableOutput(t *testing.T) {
+	ds := testDataset()
+	var first, second bytes.Buffer
+	if err := WriteFlatJSON(&first, Tables(ds)); err != nil {
+		t.Fatalf(err.Error())
+	}
+	WriteFlatJSON(&second, Tables(ds))
+	if first.String() != second.String() {
+		t.Fatalf("Flat JSON output is not stable")
+	}
+	var yamlOut bytes.Buffer
+	if err := WriteYAML(&yamlOut, ds); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !strings.Contains(yamlOut.String(), "- codename: iPhone15,4\n    modelname: iPhone 15\n    cpu:\n      code: A16_Bionic") {
+		t.Fatalf("Unexpected YAML output:\n%s", yamlOut.String())
+	}
+	var jsonOut bytes.Buffer
+	WriteJSON(&jsonOut, ds)
+	if !strings.Contains(jsonOut.String(), `"os_versions": [
+        "17.0.0",
+        "17.1.0"
+      ]`) {
+		t.Fatalf("Unexpected JSON output:\n%s", jsonOut.String())
+	}
+}
+
+func TestCSV(t *testing.T) {
+	dir := t.TempDir()
+	if err := WriteCSV(dir, Tables(testDataset())); err != nil {
+		t.Fatalf(err.Error())
+	}
+	content, err := os.ReadFile(path.Join(dir, "device_os.csv"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := "codename,family,version\niPhone15,4,ios,17.0.0\niPhone15,4,ios,17.1.0\n"
+	if string(content) != strings.Replace(expected, "iPhone15,4", `"iPhone15,4"`, -1) {
+		t.Fatalf("Unexpected device_os.csv content:\n%s", string(content))
+	}
+}
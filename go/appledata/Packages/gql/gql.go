@@ -0,0 +1,393 @@
+// Package gql serves the content of a generated DB as a GraphQL API, so
+// that a device, its processor, the OS versions it supports and their
+// builds can be fetched in a single request.
+package gql
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/version"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+)
+
+// build is the source value of the Build type.
+type build struct {
+	Build   string
+	Release *dataset.Release
+}
+
+type index struct {
+	ds               *dataset.Dataset
+	devices          map[string]*dataset.Device
+	processors       map[string]*dataset.Processor
+	processorDevices map[*dataset.Processor][]*dataset.Device
+	builds           map[string]build
+}
+
+func newIndex(ds *dataset.Dataset) *index {
+	idx := &index{
+		ds:               ds,
+		devices:          map[string]*dataset.Device{},
+		processors:       map[string]*dataset.Processor{},
+		processorDevices: map[*dataset.Processor][]*dataset.Device{},
+		builds:           map[string]build{},
+	}
+	for _, p := range ds.Processors {
+		idx.processors[p.Code] = p
+	}
+	for _, d := range ds.Devices {
+		idx.devices[d.Codename] = d
+		if d.Cpu != nil {
+			idx.processorDevices[d.Cpu] = append(idx.processorDevices[d.Cpu], d)
+		}
+	}
+	for _, r := range ds.Releases {
+		for _, b := range r.Builds {
+			idx.builds[b] = build{Build: b, Release: r}
+		}
+	}
+	return idx
+}
+
+func versionString(v *version.OSVersion) interface{} {
+	if v == nil {
+		return nil
+	}
+	return v.String()
+}
+
+func stringArg(p graphql.ResolveParams, name string) string {
+	s, _ := p.Args[name].(string)
+	return s
+}
+
+// window applies the limit and offset arguments to n items. Like the REST
+// API, it rejects negative values.
+func window(p graphql.ResolveParams, n int) (int, int, error) {
+	start, _ := p.Args["offset"].(int)
+	if start < 0 {
+		return 0, 0, fmt.Errorf("offset must be a non-negative integer, got %d", start)
+	}
+	limit, hasLimit := p.Args["limit"].(int)
+	if hasLimit && limit < 0 {
+		return 0, 0, fmt.Errorf("limit must be a non-negative integer, got %d", limit)
+	}
+	// clamped before adding limit, which could overflow past a huge offset
+	if start > n {
+		start = n
+	}
+	end := n
+	if hasLimit && limit < n-start {
+		end = start + limit
+	}
+	return start, end, nil
+}
+
+var pageArgs = graphql.FieldConfigArgument{
+	"limit":  &graphql.ArgumentConfig{Type: graphql.Int},
+	"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+}
+
+func withPageArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	for name, arg := range pageArgs {
+		args[name] = arg
+	}
+	return args
+}
+
+// Schema builds the GraphQL schema answering queries from ds. The SDL of
+// the schema is in schema.graphql.
+func Schema(ds *dataset.Dataset) (graphql.Schema, error) {
+	idx := newIndex(ds)
+
+	processorType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Processor",
+		Fields: graphql.Fields{
+			"code":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"label": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+	deviceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Device",
+		Fields: graphql.Fields{
+			"hardwareString": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(*dataset.Device).Codename, nil },
+			},
+			"modelName": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(*dataset.Device).Modelname, nil },
+			},
+			"family": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return string(version.HardwareFamily(p.Source.(*dataset.Device).Codename)), nil
+				},
+			},
+			"cpu": &graphql.Field{
+				Type: processorType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if cpu := p.Source.(*dataset.Device).Cpu; cpu != nil {
+						return cpu, nil
+					}
+					return nil, nil
+				},
+			},
+			"minOS": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return versionString(p.Source.(*dataset.Device).MinOS()), nil
+				},
+			},
+			"maxOS": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return versionString(p.Source.(*dataset.Device).MaxOS()), nil
+				},
+			},
+		},
+	})
+	osVersionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "OSVersion",
+		Fields: graphql.Fields{
+			"family": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"version": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*dataset.Release).Version.String(), nil
+				},
+			},
+			"major": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(*dataset.Release).Version.X, nil },
+			},
+			"minor": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(*dataset.Release).Version.Y, nil },
+			},
+			"patch": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(*dataset.Release).Version.Z, nil },
+			},
+			"darwin": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return versionString(p.Source.(*dataset.Release).Darwin), nil
+				},
+			},
+		},
+	})
+	buildType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Build",
+		Fields: graphql.Fields{
+			"build": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"osVersion": &graphql.Field{
+				Type:    graphql.NewNonNull(osVersionType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) { return p.Source.(build).Release, nil },
+			},
+		},
+	})
+
+	// relationships, added once every type exists
+	processorType.AddFieldConfig("devices", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(deviceType))),
+		Description: "devices built around the processor, sorted by hardware string",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return append([]*dataset.Device{}, idx.processorDevices[p.Source.(*dataset.Processor)]...), nil
+		},
+	})
+	deviceType.AddFieldConfig("osVersions", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(osVersionType))),
+		Description: "OS versions supported by the device, oldest first",
+		Args:        withPageArgs(graphql.FieldConfigArgument{}),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			releases := p.Source.(*dataset.Device).Releases
+			start, end, err := window(p, len(releases))
+			if err != nil {
+				return nil, err
+			}
+			return append([]*dataset.Release{}, releases[start:end]...), nil
+		},
+	})
+	osVersionType.AddFieldConfig("builds", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(buildType))),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			r := p.Source.(*dataset.Release)
+			builds := []build{}
+			for _, b := range r.Builds {
+				builds = append(builds, build{Build: b, Release: r})
+			}
+			return builds, nil
+		},
+	})
+	osVersionType.AddFieldConfig("devices", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(deviceType))),
+		Description: "devices supporting the version, sorted by hardware string",
+		Args:        withPageArgs(graphql.FieldConfigArgument{}),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			devices := p.Source.(*dataset.Release).Devices
+			start, end, err := window(p, len(devices))
+			if err != nil {
+				return nil, err
+			}
+			return append([]*dataset.Device{}, devices[start:end]...), nil
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"device": &graphql.Field{
+				Type: deviceType,
+				Args: graphql.FieldConfigArgument{"hardwareString": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if d, ok := idx.devices[stringArg(p, "hardwareString")]; ok {
+						return d, nil
+					}
+					return nil, nil
+				},
+			},
+			"devices": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(deviceType))),
+				Description: "devices sorted by hardware string; supports keeps the devices whose supported range includes that version",
+				Args: withPageArgs(graphql.FieldConfigArgument{
+					"family":   &graphql.ArgumentConfig{Type: graphql.String},
+					"cpu":      &graphql.ArgumentConfig{Type: graphql.String},
+					"supports": &graphql.ArgumentConfig{Type: graphql.String},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filter := dataset.DeviceFilter{Family: stringArg(p, "family"), Cpu: stringArg(p, "cpu")}
+					if raw := stringArg(p, "supports"); raw != "" {
+						v, err := version.OSVersionFromString(raw)
+						if err != nil {
+							return nil, fmt.Errorf("supports: bad version %q", raw)
+						}
+						filter.Supports = &v
+					}
+					matches := ds.FilterDevices(filter)
+					start, end, err := window(p, len(matches))
+					if err != nil {
+						return nil, err
+					}
+					return matches[start:end], nil
+				},
+			},
+			"processor": &graphql.Field{
+				Type: processorType,
+				Args: graphql.FieldConfigArgument{"code": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if proc, ok := idx.processors[stringArg(p, "code")]; ok {
+						return proc, nil
+					}
+					return nil, nil
+				},
+			},
+			"processors": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(processorType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return ds.Processors, nil
+				},
+			},
+			"osVersion": &graphql.Field{
+				Type: osVersionType,
+				Args: graphql.FieldConfigArgument{
+					"family":  &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "ios"},
+					"version": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					v, err := version.OSVersionFromString(stringArg(p, "version"))
+					if err != nil {
+						return nil, fmt.Errorf("version: bad version %q", stringArg(p, "version"))
+					}
+					for _, r := range ds.Releases {
+						if r.Family == stringArg(p, "family") && r.Version.Eq(v) {
+							return r, nil
+						}
+					}
+					return nil, nil
+				},
+			},
+			"osVersions": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(osVersionType))),
+				Description: "releases of an OS family, oldest first",
+				Args: withPageArgs(graphql.FieldConfigArgument{
+					"family": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "ios"},
+					"major":  &graphql.ArgumentConfig{Type: graphql.Int},
+				}),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					major, filterMajor := p.Args["major"].(int)
+					matches := []*dataset.Release{}
+					for _, r := range ds.Releases {
+						if r.Family != stringArg(p, "family") || (filterMajor && r.Version.X != major) {
+							continue
+						}
+						matches = append(matches, r)
+					}
+					start, end, err := window(p, len(matches))
+					if err != nil {
+						return nil, err
+					}
+					return matches[start:end], nil
+				},
+			},
+			"build": &graphql.Field{
+				Type: buildType,
+				Args: graphql.FieldConfigArgument{"build": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if b, ok := idx.builds[stringArg(p, "build")]; ok {
+						return b, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// Request is the body of a GraphQL POST request.
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Handler serves schema over HTTP: GET requests with a query parameter,
+// or POST requests with a JSON Request body.
+func Handler(schema graphql.Schema) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		switch r.Method {
+		case http.MethodGet:
+			req.Query = r.URL.Query().Get("query")
+			req.OperationName = r.URL.Query().Get("operationName")
+			if vars := r.URL.Query().Get("variables"); vars != "" {
+				if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+					http.Error(w, "variables: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  req.Query,
+			OperationName:  req.OperationName,
+			VariableValues: req.Variables,
+			Context:        r.Context(),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	})
+}
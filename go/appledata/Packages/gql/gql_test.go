@@ -0,0 +1,151 @@
+package gql
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/dbtools"
+	"appledata/Packages/version"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+)
+
+func v(s string) version.OSVersion {
+	ver, _ := version.OSVersionFromString(s)
+	return ver
+}
+
+func testSchema(t *testing.T) graphql.Schema {
+	dbfile := path.Join(t.TempDir(), dbtools.DB_NAME)
+	s, err := dbtools.NewSQLStore(dbfile, dbtools.Options{})
+	if err != nil {
+		t.Fatalf("NewSQLStore: %s", err.Error())
+	}
+	s.UpdateCPU("A16_Bionic", "A16 Bionic")
+	for ver, builds := range map[string][]string{"16.0": {"20A362"}, "17.0": {"21A329"}, "17.0.1": {"21A341", "21A340"}} {
+		iv := version.IOSVersion{Version: v(ver)}
+		for _, b := range builds {
+			bn, _ := version.BuildNumberFromString(b)
+			iv.Builds = append(iv.Builds, bn)
+		}
+		s.AddIOSVersion(iv)
+	}
+	s.AddDevice("iPhone 15", "iPhone15,4", "Apple A16 Bionic", v("17.0"), v("17.0.1"))
+	s.AddDevice("iPhone 14", "iPhone14,7", "Apple A15 Bionic", v("16.0"), v("17.0"))
+	if err := s.Flush(dbtools.BuildMetadata{Mode: "generate"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	ds, err := dataset.LoadFile(dbfile)
+	if err != nil {
+		t.Fatalf("LoadFile: %s", err.Error())
+	}
+	schema, err := Schema(ds)
+	if err != nil {
+		t.Fatalf("Schema: %s", err.Error())
+	}
+	return schema
+}
+
+func run(t *testing.T, schema graphql.Schema, query string) string {
+	t.Helper()
+	result := graphql.Do(graphql.Params{Schema: schema, RequestString: query})
+	if result.HasErrors() {
+		t.Fatalf("%s: %v", query, result.Errors)
+	}
+	out, _ := json.Marshal(result.Data)
+	return string(out)
+}
+
+func TestQueries(t *testing.T) {
+	schema := testSchema(t)
+
+	out := run(t, schema, `{ device(hardwareString: "iPhone15,4") { modelName family cpu { code label } osVersions { version builds { build } } } }`)
+	expected := `{"device":{"cpu":{"code":"A16_Bionic","label":"A16 Bionic"},"family":"iPhone","modelName":"iPhone 15","osVersions":[{"builds":[{"build":"21A329"}],"version":"17.0.0"},{"builds":[{"build":"21A340"},{"build":"21A341"}],"version":"17.0.1"}]}}`
+	if out != expected {
+		t.Fatalf("Expected %s, got %s", expected, out)
+	}
+	out = run(t, schema, `{ build(build: "20A362") { osVersion { major devices { hardwareString cpu { code } } } } }`)
+	expected = `{"build":{"osVersion":{"devices":[{"cpu":null,"hardwareString":"iPhone14,7"}],"major":16}}}`
+	if out != expected {
+		t.Fatalf("Expected %s, got %s", expected, out)
+	}
+	out = run(t, schema, `{ devices(supports: "17.0.1") { hardwareString } processor(code: "A16_Bionic") { devices { maxOS } } osVersions(major: 17, limit: 1) { version } }`)
+	expected = `{"devices":[{"hardwareString":"iPhone15,4"}],"osVersions":[{"version":"17.0.0"}],"processor":{"devices":[{"maxOS":"17.0.1"}]}}`
+	if out != expected {
+		t.Fatalf("Expected %s, got %s", expected, out)
+	}
+	out = run(t, schema, `{ device(hardwareString: "iPhone99,1") { modelName } }`)
+	if out != `{"device":null}` {
+		t.Fatalf("Expected a null device, got %s", out)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	schema := testSchema(t)
+	out := run(t, schema, `{ devices(offset: 1, limit: 5) { hardwareString } osVersions(offset: 9223372036854775807) { version } }`)
+	if expected := `{"devices":[{"hardwareString":"iPhone15,4"}],"osVersions":[]}`; out != expected {
+		t.Fatalf("Expected %s, got %s", expected, out)
+	}
+	for _, query := range []string{
+		`{ devices(offset: -1) { hardwareString } }`,
+		`{ osVersions(limit: -1) { version } }`,
+		`{ device(hardwareString: "iPhone15,4") { osVersions(offset: -2) { version } } }`,
+	} {
+		result := graphql.Do(graphql.Params{Schema: schema, RequestString: query})
+		if !result.HasErrors() || !strings.Contains(result.Errors[0].Message, "must be a non-negative integer") {
+			t.Fatalf("%s: expected a negative value error, got %v", query, result.Errors)
+		}
+	}
+}
+
+// TestSchemaFile makes sure schema.graphql lists the fields the schema
+// actually serves.
+func TestSchemaFile(t *testing.T) {
+	schema := testSchema(t)
+	sdl, err := os.ReadFile("schema.graphql")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	fromFile := map[string][]string{}
+	typeRegex := regexp.MustCompile(`(?s)type (\w+) \{(.*?)\n\}`)
+	fieldRegex := regexp.MustCompile(`(?m)^  (\w+)[(:]`)
+	for _, m := range typeRegex.FindAllStringSubmatch(string(sdl), -1) {
+		for _, f := range fieldRegex.FindAllStringSubmatch(m[2], -1) {
+			fromFile[m[1]] = append(fromFile[m[1]], f[1])
+		}
+		sort.Strings(fromFile[m[1]])
+	}
+	for _, name := range []string{"Query", "Device", "Processor", "OSVersion", "Build"} {
+		var served []string
+		for field := range schema.Type(name).(*graphql.Object).Fields() {
+			served = append(served, field)
+		}
+		sort.Strings(served)
+		if strings.Join(served, " ") != strings.Join(fromFile[name], " ") {
+			t.Fatalf("%s: schema.graphql lists %v, the schema serves %v", name, fromFile[name], served)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	handler := Handler(testSchema(t))
+
+	body := strings.NewReader(`{"query": "query($hw: String!) { device(hardwareString: $hw) { modelName } }", "variables": {"hw": "iPhone14,7"}}`)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", body))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"data":{"device":{"modelName":"iPhone 14"}}}` {
+		t.Fatalf("Unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/graphql?query=%7Bprocessors%7Bcode%7D%7D", nil))
+	if !strings.Contains(rec.Body.String(), `"A16_Bionic"`) {
+		t.Fatalf("Unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,132 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// WriterNotifier writes one line per event to W.
+type WriterNotifier struct {
+	W io.Writer
+}
+
+func (n *WriterNotifier) Notify(events []Event) error {
+	for _, e := range events {
+		if _, err := fmt.Fprintln(n.W, e.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSONLinesNotifier appends one JSON object per event to the file at Path,
+// which is created when missing.
+type JSONLinesNotifier struct {
+	Path string
+}
+
+func (n *JSONLinesNotifier) Notify(events []Event) error {
+	f, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	for _, e := range events {
+		if err := encoder.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// WebhookPayload is the body POSTed by WebhookNotifier.
+type WebhookPayload struct {
+	Events []Event `json:"events"`
+}
+
+// WebhookNotifier POSTs the events of a run as a single WebhookPayload to
+// URL. Any status other than 2xx is an error.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client // a client with a 30s timeout when nil
+}
+
+func (n *WebhookNotifier) Notify(events []Event) error {
+	body, err := json.Marshal(WebhookPayload{Events: events})
+	if err != nil {
+		return err
+	}
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	res, err := client.Post(n.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", n.URL, res.Status)
+	}
+	return nil
+}
+
+// SMTPNotifier emails the events of a run, one per line, through the
+// server at Addr (host:port). Auth is optional.
+type SMTPNotifier struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+	To   []string
+}
+
+func parseSMTP(spec string) (Notifier, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("%q: missing port", spec)
+	}
+	n := &SMTPNotifier{Addr: u.Host, From: u.Query().Get("from")}
+	for _, to := range strings.Split(u.Query().Get("to"), ",") {
+		if to != "" {
+			n.To = append(n.To, to)
+		}
+	}
+	if n.From == "" || len(n.To) == 0 {
+		return nil, fmt.Errorf("%q: expected from and to parameters", spec)
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		n.Auth = smtp.PlainAuth("", u.User.Username(), password, u.Hostname())
+	}
+	return n, nil
+}
+
+// message returns the email sent for events, headers included.
+func (n *SMTPNotifier) message(events []Event) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", n.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&buf, "Subject: appledata: %d new OS versions, builds or devices\r\n", len(events))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	for _, e := range events {
+		fmt.Fprintf(&buf, "%s\r\n", e.String())
+	}
+	return buf.Bytes()
+}
+
+func (n *SMTPNotifier) Notify(events []Event) error {
+	return smtp.SendMail(n.Addr, n.Auth, n.From, n.To, n.message(events))
+}
@@ -0,0 +1,107 @@
+// Package notify turns the changes applied by a sync run into events about
+// newly discovered OS versions, builds and devices, and sends them to
+// notifiers: stdout, a JSON lines file, a webhook or an email.
+package notify
+
+import (
+	"appledata/Packages/dbtools"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	KindOSVersion = dbtools.EntityOSVersion
+	KindBuild     = dbtools.EntityBuild
+	KindDevice    = dbtools.EntityDevice
+)
+
+// Event reports an entity found by a sync run that was not in the DB yet.
+type Event struct {
+	Kind string `json:"kind"` // one of the Kind constants
+	Key  string `json:"key"`  // version, build number or hardware string
+	// Detail is the detail of the insert change, e.g. the version of a
+	// build
+	Detail     string    `json:"detail,omitempty"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+func (e Event) String() string {
+	name := map[string]string{KindOSVersion: "OS version", KindBuild: "build", KindDevice: "device"}[e.Kind]
+	if e.Detail == "" {
+		return fmt.Sprintf("new %s %s", name, e.Key)
+	}
+	return fmt.Sprintf("new %s %s (%s)", name, e.Key, e.Detail)
+}
+
+// Events returns, in the order of changes, an event for each inserted OS
+// version, build and device. Updates, deletes, new device/OS associations
+// and the changes of an initial import, where everything is new, are left
+// out.
+func Events(changes []dbtools.Change, detectedAt time.Time) []Event {
+	var events []Event
+	for _, c := range changes {
+		if c.Action != dbtools.ChangeInsert || c.Initial {
+			continue
+		}
+		switch c.Entity {
+		case KindOSVersion, KindBuild, KindDevice:
+			events = append(events, Event{Kind: c.Entity, Key: c.Key, Detail: c.Detail, DetectedAt: detectedAt})
+		}
+	}
+	return events
+}
+
+// Notifier sends the events of a run somewhere. Notify is only called
+// with at least one event.
+type Notifier interface {
+	Notify(events []Event) error
+}
+
+// Parse builds a notifier from its command line spec:
+//
+//	stdout                                   one line per event on stdout
+//	jsonl:<path>                             one JSON object per event appended to path
+//	webhook:<url>                            events POSTed as JSON to url
+//	smtp://[user:pass@]host:port?from=a&to=b,c  events emailed from a to b and c
+func Parse(spec string) (Notifier, error) {
+	switch {
+	case spec == "stdout":
+		return &WriterNotifier{W: os.Stdout}, nil
+	case strings.HasPrefix(spec, "jsonl:"):
+		path := strings.TrimPrefix(spec, "jsonl:")
+		if path == "" {
+			return nil, fmt.Errorf("%q: missing file path", spec)
+		}
+		return &JSONLinesNotifier{Path: path}, nil
+	case strings.HasPrefix(spec, "webhook:"):
+		u, err := url.Parse(strings.TrimPrefix(spec, "webhook:"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%q: expected webhook:http(s)://host/path", spec)
+		}
+		return &WebhookNotifier{URL: u.String()}, nil
+	case strings.HasPrefix(spec, "smtp://"):
+		return parseSMTP(spec)
+	}
+	return nil, fmt.Errorf("unknown notifier %q, expected stdout, jsonl:<path>, webhook:<url> or smtp://host:port?from=...&to=...", spec)
+}
+
+// NotifyAll sends events to every notifier, logging failures instead of
+// stopping at the first one, and returns the number of failed notifiers.
+func NotifyAll(notifiers []Notifier, events []Event) int {
+	if len(events) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, n := range notifiers {
+		if err := n.Notify(events); err != nil {
+			log.Errorf("[notify] %T: %s", n, err.Error())
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,61 @@
+// Package output writes the results of the commands in the formats they
+// share: aligned columns, indented JSON and CSV.
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+var Formats = []string{FormatTable, FormatJSON, FormatCSV}
+
+// Writers maps format names to the functions writing a result in that
+// format.
+type Writers map[string]func(w io.Writer) error
+
+// Write writes to w with the writer of format.
+func (ws Writers) Write(w io.Writer, format string) error {
+	write, ok := ws[format]
+	if !ok {
+		return fmt.Errorf("unknown format %s", format)
+	}
+	return write(w)
+}
+
+// JSON writes v as indented JSON.
+func JSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// Table writes header and rows as columns aligned with spaces.
+func Table(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// CSV writes header and rows as CSV records.
+func CSV(w io.Writer, header []string, rows [][]string) error {
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	for _, row := range rows {
+		writer.Write(row)
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,30 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWriters(t *testing.T) {
+	header := []string{"hardware_string", "model_name"}
+	rows := [][]string{{"iPhone15,4", "iPhone 15"}, {"iPad7,5", "iPad (6th generation)"}}
+	writers := Writers{
+		FormatTable: func(w io.Writer) error { return Table(w, []string{"HARDWARE", "MODEL"}, rows) },
+		FormatJSON:  func(w io.Writer) error { return JSON(w, map[string]int{"devices": len(rows)}) },
+		FormatCSV:   func(w io.Writer) error { return CSV(w, header, rows) },
+	}
+	for format, expected := range map[string]string{
+		FormatTable: "HARDWARE    MODEL\niPhone15,4  iPhone 15\niPad7,5     iPad (6th generation)\n",
+		FormatJSON:  "{\n  \"devices\": 2\n}\n",
+		FormatCSV:   "hardware_string,model_name\n\"iPhone15,4\",iPhone 15\n\"iPad7,5\",iPad (6th generation)\n",
+	} {
+		var buf bytes.Buffer
+		if err := writers.Write(&buf, format); err != nil || buf.String() != expected {
+			t.Fatalf("%s: expected\n%s\ngot\n%s %v", format, expected, buf.String(), err)
+		}
+	}
+	if err := writers.Write(io.Discard, "xml"); err == nil {
+		t.Fatalf("Unknown formats should be rejected")
+	}
+}
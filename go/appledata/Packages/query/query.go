@@ -0,0 +1,405 @@
+// Package query answers the common questions about a generated DB with
+// typed results, without any knowledge of its tables on the caller side.
+// It only ever opens DBs read-only, independently of any dbtools.Store.
+package query
+
+import (
+	"appledata/Packages/dbtools"
+	"appledata/Packages/version"
+	"errors"
+	"fmt"
+	stdlog "log"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SchemaVersion is the DB schema version this package was written
+// against. Open refuses DBs that are not compatible with it.
+const SchemaVersion = 4
+
+// TimelinesSchemaVersion is the DB schema version introducing device
+// timelines; older DBs answer the timeline queries with ErrNoTimelines.
+const TimelinesSchemaVersion = 7
+
+var ErrNotFound = errors.New("not found")
+
+type Processor struct {
+	Code  string
+	Label string
+}
+
+type Device struct {
+	HardwareString string
+	ModelName      string
+	Cpu            *Processor // nil when unknown
+}
+
+// OSRelease is an OS version along with its build numbers.
+type OSRelease struct {
+	Family   string
+	Version  version.OSVersion
+	Builds   []string
+	Darwin   *version.OSVersion // kernel version, nil when unknown
+	Released *time.Time         // release date, nil when unknown
+}
+
+// DB is a read-only handle on a generated DB. It is safe for concurrent
+// use.
+type DB struct {
+	db     *gorm.DB
+	schema int // schema version of the DB
+}
+
+// Open opens the DB file at dbfile read-only and checks that its schema is
+// compatible with this package.
+func Open(dbfile string) (*DB, error) {
+	db, err := dbtools.OpenReadOnly(dbfile)
+	if err != nil {
+		return nil, err
+	}
+	// a missing row is a regular ErrNotFound answer here, not worth a log line
+	quiet := logger.New(stdlog.New(os.Stderr, "\r\n", stdlog.LstdFlags), logger.Config{
+		SlowThreshold:             200 * time.Millisecond,
+		LogLevel:                  logger.Warn,
+		IgnoreRecordNotFoundError: true,
+	})
+	q := &DB{db: db.Session(&gorm.Session{Logger: quiet})}
+	schema, err := dbtools.CheckSchemaDB(db, SchemaVersion)
+	if err != nil {
+		q.Close()
+		return nil, fmt.Errorf("%s: %w", dbfile, err)
+	}
+	q.schema = schema
+	return q, nil
+}
+
+func (q *DB) Close() error {
+	sqlDB, err := q.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Gorm exposes the underlying connection, for queries this package does
+// not cover.
+func (q *DB) Gorm() *gorm.DB {
+	return q.db
+}
+
+func notFound(err error, format string, args ...interface{}) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), ErrNotFound)
+	}
+	return err
+}
+
+func toDevice(d dbtools.Device) Device {
+	dev := Device{HardwareString: d.Codename, ModelName: d.Modelname}
+	if d.Cpu.ID != 0 {
+		dev.Cpu = &Processor{Code: d.Cpu.Code, Label: d.Cpu.Label}
+	}
+	return dev
+}
+
+func toRelease(o dbtools.OperatingSystem) OSRelease {
+	rel := OSRelease{Family: o.Name, Version: version.OSVersion{X: o.VersionX, Y: o.VersionY, Z: o.VersionZ}, Darwin: o.DarwinVersion, Released: o.ReleaseDate}
+	for _, bn := range o.BuildNumbers {
+		rel.Builds = append(rel.Builds, bn.BuildNumber)
+	}
+	return rel
+}
+
+func orderBuilds(tx *gorm.DB) *gorm.DB {
+	return tx.Order("build_number")
+}
+
+// DeviceByHardwareString returns the device identified by hardwareString,
+// e.g. "iPhone15,4".
+func (q *DB) DeviceByHardwareString(hardwareString string) (Device, error) {
+	var d dbtools.Device
+	err := q.db.Preload("Cpu").Where("codename = ?", hardwareString).First(&d).Error
+	if err != nil {
+		return Device{}, notFound(err, "device %s", hardwareString)
+	}
+	return toDevice(d), nil
+}
+
+// DevicesSupporting returns, sorted by hardware string, the devices that
+// can run version v of OS family (e.g. "ios").
+func (q *DB) DevicesSupporting(family string, v version.OSVersion) ([]Device, error) {
+	var devices []dbtools.Device
+	err := q.db.Preload("Cpu").
+		Joins("JOIN device_os ON device_os.device_id = devices.id").
+		Joins("JOIN operating_systems ON operating_systems.id = device_os.operating_system_id").
+		Where("operating_systems.name = ? AND operating_systems.version_x = ? AND operating_systems.version_y = ? AND operating_systems.version_z = ?", family, v.X, v.Y, v.Z).
+		Order("devices.codename").Find(&devices).Error
+	if err != nil {
+		return nil, err
+	}
+	return toDevices(devices), nil
+}
+
+func toDevices(devices []dbtools.Device) []Device {
+	out := make([]Device, 0, len(devices))
+	for _, d := range devices {
+		out = append(out, toDevice(d))
+	}
+	return out
+}
+
+func orderHardware(tx *gorm.DB) *gorm.DB {
+	return tx.Order("devices.hardware_prefix, devices.hardware_major, devices.hardware_minor")
+}
+
+// DevicesOfFamily returns, in hardware identifier order, the devices of
+// family, e.g. version.FamilyMac for every MacBookPro, iMac, etc.
+func (q *DB) DevicesOfFamily(family version.DeviceFamily) ([]Device, error) {
+	var devices []dbtools.Device
+	err := orderHardware(q.db.Preload("Cpu").Where("hardware_family = ?", string(family))).Find(&devices).Error
+	if err != nil {
+		return nil, err
+	}
+	return toDevices(devices), nil
+}
+
+// DevicesInRange returns, in hardware identifier order, the devices
+// between from and to included, e.g. iPhone10,1 to iPhone12,8. Both bounds
+// must share the same prefix.
+func (q *DB) DevicesInRange(from version.HardwareIdentifier, to version.HardwareIdentifier) ([]Device, error) {
+	if from.Prefix != to.Prefix {
+		return nil, fmt.Errorf("range %s-%s spans several hardware prefixes", from.String(), to.String())
+	}
+	var devices []dbtools.Device
+	err := orderHardware(q.db.Preload("Cpu").
+		Where("hardware_prefix = ?", from.Prefix).
+		Where("hardware_major > ? OR (hardware_major = ? AND hardware_minor >= ?)", from.Major, from.Major, from.Minor).
+		Where("hardware_major < ? OR (hardware_major = ? AND hardware_minor <= ?)", to.Major, to.Major, to.Minor)).
+		Find(&devices).Error
+	if err != nil {
+		return nil, err
+	}
+	return toDevices(devices), nil
+}
+
+// LatestOSFor returns the most recent release supported by the device
+// identified by hardwareString.
+func (q *DB) LatestOSFor(hardwareString string) (OSRelease, error) {
+	var o dbtools.OperatingSystem
+	err := q.db.Preload("BuildNumbers", orderBuilds).
+		Joins("JOIN device_os ON device_os.operating_system_id = operating_systems.id").
+		Joins("JOIN devices ON devices.id = device_os.device_id").
+		Where("devices.codename = ?", hardwareString).
+		Order("operating_systems.version_x DESC, operating_systems.version_y DESC, operating_systems.version_z DESC").
+		First(&o).Error
+	if err != nil {
+		return OSRelease{}, notFound(err, "release for device %s", hardwareString)
+	}
+	return toRelease(o), nil
+}
+
+// BuildsFor returns the build numbers of version v of OS family.
+func (q *DB) BuildsFor(family string, v version.OSVersion) ([]string, error) {
+	var o dbtools.OperatingSystem
+	err := q.db.Preload("BuildNumbers", orderBuilds).
+		Where("name = ? AND version_x = ? AND version_y = ? AND version_z = ?", family, v.X, v.Y, v.Z).
+		First(&o).Error
+	if err != nil {
+		return nil, notFound(err, "%s %s", family, v.String())
+	}
+	return toRelease(o).Builds, nil
+}
+
+// ReleasesIn returns, in ascending order, the releases of OS family whose
+// version is in set, e.g. the releases matched by a rule stored as
+// ">=15.0 <17".
+func (q *DB) ReleasesIn(family string, set version.OSVersionSet) ([]OSRelease, error) {
+	var releases []dbtools.OperatingSystem
+	err := q.db.Preload("BuildNumbers", orderBuilds).Where("name = ?", family).
+		Order("version_x, version_y, version_z").Find(&releases).Error
+	if err != nil {
+		return nil, err
+	}
+	out := []OSRelease{}
+	for _, o := range releases {
+		if rel := toRelease(o); set.Contains(rel.Version) {
+			out = append(out, rel)
+		}
+	}
+	return out, nil
+}
+
+// ReleasesWithDarwin returns, in ascending order, the releases of OS
+// family running Darwin version darwin, e.g. 17.4.0 and 17.4.1 for
+// "23.4.0". A crash log or a CFNetwork User-Agent cannot tell them apart.
+// DBs predating the darwin_version column have none.
+func (q *DB) ReleasesWithDarwin(family string, darwin version.OSVersion) ([]OSRelease, error) {
+	all, err := q.ReleasesIn(family, version.AllOSVersions)
+	if err != nil {
+		return nil, err
+	}
+	out := []OSRelease{}
+	for _, rel := range all {
+		if rel.Darwin != nil && rel.Darwin.Eq(darwin) {
+			out = append(out, rel)
+		}
+	}
+	return out, nil
+}
+
+// VersionForBuild returns the release build belongs to, e.g. 17.0.0 for
+// "21A329".
+func (q *DB) VersionForBuild(build string) (OSRelease, error) {
+	var bn dbtools.BuildNumber
+	if err := q.db.Where("build_number = ?", build).First(&bn).Error; err != nil {
+		return OSRelease{}, notFound(err, "build %s", build)
+	}
+	var o dbtools.OperatingSystem
+	if err := q.db.Preload("BuildNumbers", orderBuilds).First(&o, bn.OperatingSystemRef).Error; err != nil {
+		return OSRelease{}, notFound(err, "release of build %s", build)
+	}
+	return toRelease(o), nil
+}
+
+// BuildResolution is the release a build string resolves to.
+type BuildResolution struct {
+	Release OSRelease
+	// Build is the known build Release was found by: the requested one
+	// when Exact, the closest known one otherwise.
+	Build string
+	Exact bool
+}
+
+// ResolveBuild resolves build to its release when it is known, or else to
+// the release of the closest known build of the same iOS major version:
+// the latest one built before it, or the earliest one after it when there
+// is none. This answers for builds newer than the DB, betas, or
+// device-specific rebuilds.
+func (q *DB) ResolveBuild(build string) (BuildResolution, error) {
+	rel, err := q.VersionForBuild(build)
+	if err == nil {
+		return BuildResolution{Release: rel, Build: build, Exact: true}, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return BuildResolution{}, err
+	}
+	target, err := version.BuildNumberFromString(build)
+	if err != nil {
+		return BuildResolution{}, fmt.Errorf("%q is not a build number: %w", build, err)
+	}
+	major, err := target.IOSMajor()
+	if err != nil {
+		return BuildResolution{}, err
+	}
+	var known []dbtools.BuildNumber
+	if err := q.db.Find(&known).Error; err != nil {
+		return BuildResolution{}, err
+	}
+	var before, after *version.BuildNumber
+	var beforeName, afterName string
+	for _, k := range known {
+		bn, err := version.BuildNumberFromString(k.BuildNumber)
+		if err != nil {
+			continue
+		}
+		if m, err := bn.IOSMajor(); err != nil || m != major {
+			continue
+		}
+		if bn.Lte(target) && (before == nil || bn.Gt(*before)) {
+			before, beforeName = &bn, k.BuildNumber
+		} else if bn.Gt(target) && (after == nil || bn.Lt(*after)) {
+			after, afterName = &bn, k.BuildNumber
+		}
+	}
+	nearest := beforeName
+	if before == nil {
+		nearest = afterName
+	}
+	if nearest == "" {
+		return BuildResolution{}, fmt.Errorf("no known build of iOS %d near %s: %w", major, build, ErrNotFound)
+	}
+	rel, err = q.VersionForBuild(nearest)
+	if err != nil {
+		return BuildResolution{}, err
+	}
+	return BuildResolution{Release: rel, Build: nearest}, nil
+}
+
+// Timeline is the support span of a device on an OS family, as computed
+// by the generator (see dbtools.DeviceTimeline).
+type Timeline struct {
+	Device         Device
+	Family         string
+	ShippingOS     version.OSVersion
+	ShippingDate   *time.Time // nil when unknown
+	LastMajor      int
+	LastUpdate     version.OSVersion
+	LastUpdateDate *time.Time // nil when unknown
+	SupportYears   *float64   // nil when either date is unknown
+	DroppedBy      *int       // nil while the device runs the latest major version
+}
+
+// ErrNoTimelines is returned by the timeline queries on DBs generated
+// before device timelines were introduced (schema version 7).
+var ErrNoTimelines = errors.New("the db has no device timelines, regenerate it with a newer generator")
+
+func (q *DB) timelines(tx *gorm.DB) ([]Timeline, error) {
+	if q.schema < TimelinesSchemaVersion {
+		return nil, ErrNoTimelines
+	}
+	var rows []dbtools.DeviceTimeline
+	err := tx.Joins("JOIN devices ON devices.codename = device_timelines.codename").
+		Scopes(orderHardware).Order("device_timelines.family").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	var codenames []string
+	for _, r := range rows {
+		codenames = append(codenames, r.Codename)
+	}
+	var devices []dbtools.Device
+	if err := q.db.Preload("Cpu").Where("codename IN ?", codenames).Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	byCodename := map[string]Device{}
+	for _, d := range devices {
+		byCodename[d.Codename] = toDevice(d)
+	}
+	out := []Timeline{}
+	for _, r := range rows {
+		out = append(out, Timeline{
+			Device:         byCodename[r.Codename],
+			Family:         r.Family,
+			ShippingOS:     r.ShippingOS,
+			ShippingDate:   r.ShippingDate,
+			LastMajor:      r.LastMajor,
+			LastUpdate:     r.LastUpdate,
+			LastUpdateDate: r.LastUpdateDate,
+			SupportYears:   r.SupportYears,
+			DroppedBy:      r.DroppedBy,
+		})
+	}
+	return out, nil
+}
+
+// Timelines returns, in hardware identifier order, the timeline of every
+// device on OS family.
+func (q *DB) Timelines(family string) ([]Timeline, error) {
+	return q.timelines(q.db.Where("device_timelines.family = ?", family))
+}
+
+// TimelineFor returns the timeline on OS family of the device identified
+// by hardwareString.
+func (q *DB) TimelineFor(family string, hardwareString string) (Timeline, error) {
+	timelines, err := q.timelines(q.db.Where("device_timelines.family = ? AND device_timelines.codename = ?", family, hardwareString))
+	if err != nil {
+		return Timeline{}, err
+	}
+	if len(timelines) == 0 {
+		return Timeline{}, fmt.Errorf("timeline of device %s: %w", hardwareString, ErrNotFound)
+	}
+	return timelines[0], nil
+}
@@ -0,0 +1,246 @@
+package query
+
+import (
+	"appledata/Packages/dbtools"
+	"appledata/Packages/version"
+	"errors"
+	"path"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func v(s string) version.OSVersion {
+	ver, _ := version.OSVersionFromString(s)
+	return ver
+}
+
+func testDBFile(t *testing.T) string {
+	dbfile := path.Join(t.TempDir(), dbtools.DB_NAME)
+	s, err := dbtools.NewSQLStore(dbfile, dbtools.Options{})
+	if err != nil {
+		t.Fatalf("NewSQLStore: %s", err.Error())
+	}
+	s.UpdateCPU("A16_Bionic", "A16 Bionic")
+	released := map[string]string{"16.0": "2022-09-12", "17.0": "2023-09-18", "17.0.1": "2023-09-21"}
+	for ver, builds := range map[string][]string{"16.0": {"20A362"}, "17.0": {"21A329"}, "17.0.1": {"21A341", "21A340"}} {
+		darwin, _ := version.IOSToDarwin(v(ver))
+		date, _ := time.Parse(version.ReleaseDateLayout, released[ver])
+		iv := version.IOSVersion{Version: v(ver), Darwin: &darwin, Released: &date}
+		for _, b := range builds {
+			bn, _ := version.BuildNumberFromString(b)
+			iv.Builds = append(iv.Builds, bn)
+		}
+		s.AddIOSVersion(iv)
+	}
+	s.AddDevice("iPhone 15", "iPhone15,4", "Apple A16 Bionic", v("17.0"), v("17.0.1"))
+	s.AddDevice("iPhone 14", "iPhone14,7", "Apple A15 Bionic", v("16.0"), v("17.0"))
+	s.AddDevice("iPhone 7", "iPhone9,1", "Apple A10 Fusion", v("16.0"), v("16.0"))
+	if err := s.Flush(dbtools.BuildMetadata{Mode: "generate"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	return dbfile
+}
+
+func testDB(t *testing.T) *DB {
+	q, err := Open(testDBFile(t))
+	if err != nil {
+		t.Fatalf("Open: %s", err.Error())
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestOlderSchema(t *testing.T) {
+	dbfile := testDBFile(t)
+	db, err := gorm.Open(sqlite.Open(dbfile), &gorm.Config{})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// a DB generated before release dates and timelines
+	if err := db.Where("version > ?", 6).Delete(&dbtools.SchemaInfo{}).Error; err != nil {
+		t.Fatalf(err.Error())
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+	q, err := Open(dbfile)
+	if err != nil {
+		t.Fatalf("A schema 6 DB should open: %s", err.Error())
+	}
+	defer q.Close()
+	if dev, err := q.DeviceByHardwareString("iPhone15,4"); err != nil || dev.ModelName != "iPhone 15" {
+		t.Fatalf("Unexpected device on a schema 6 DB: %+v %v", dev, err)
+	}
+	if _, err := q.Timelines("ios"); !errors.Is(err, ErrNoTimelines) {
+		t.Fatalf("Expected ErrNoTimelines, got %v", err)
+	}
+	if _, err := q.TimelineFor("ios", "iPhone15,4"); !errors.Is(err, ErrNoTimelines) {
+		t.Fatalf("Expected ErrNoTimelines, got %v", err)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	q := testDB(t)
+
+	dev, err := q.DeviceByHardwareString("iPhone15,4")
+	if err != nil || dev.ModelName != "iPhone 15" || dev.Cpu == nil || dev.Cpu.Code != "A16_Bionic" {
+		t.Fatalf("Unexpected device: %+v %v", dev, err)
+	}
+	dev, err = q.DeviceByHardwareString("iPhone14,7")
+	if err != nil || dev.Cpu != nil {
+		t.Fatalf("Device with unknown cpu should have a nil Cpu: %+v %v", dev, err)
+	}
+	if _, err := q.DeviceByHardwareString("iPhone1,1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	devices, err := q.DevicesSupporting("ios", v("17.0"))
+	if err != nil || len(devices) != 2 || devices[0].HardwareString != "iPhone14,7" || devices[1].HardwareString != "iPhone15,4" {
+		t.Fatalf("Unexpected devices supporting 17.0: %+v %v", devices, err)
+	}
+	devices, _ = q.DevicesSupporting("ios", v("17.0.1"))
+	if len(devices) != 1 {
+		t.Fatalf("Unexpected devices supporting 17.0.1: %+v", devices)
+	}
+
+	latest, err := q.LatestOSFor("iPhone14,7")
+	if err != nil || !latest.Version.Eq(v("17.0")) {
+		t.Fatalf("Unexpected latest OS: %+v %v", latest, err)
+	}
+
+	builds, err := q.BuildsFor("ios", v("17.0.1"))
+	if err != nil || len(builds) != 2 || builds[0] != "21A340" {
+		t.Fatalf("Unexpected builds: %v %v", builds, err)
+	}
+	if _, err := q.BuildsFor("ios", v("1.0")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	rel, err := q.VersionForBuild("21A341")
+	if err != nil || !rel.Version.Eq(v("17.0.1")) {
+		t.Fatalf("Unexpected release for build: %+v %v", rel, err)
+	}
+	if _, err := q.VersionForBuild("99Z999"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func hw(s string) version.HardwareIdentifier {
+	h, _ := version.HardwareIdentifierFromString(s)
+	return h
+}
+
+func TestHardwareQueries(t *testing.T) {
+	q := testDB(t)
+
+	devices, err := q.DevicesOfFamily(version.FamilyIPhone)
+	if err != nil || len(devices) != 3 || devices[0].HardwareString != "iPhone9,1" || devices[2].HardwareString != "iPhone15,4" {
+		t.Fatalf("Unexpected iPhones: %+v %v", devices, err)
+	}
+	devices, err = q.DevicesInRange(hw("iPhone9,2"), hw("iPhone15,4"))
+	if err != nil || len(devices) != 2 || devices[0].HardwareString != "iPhone14,7" {
+		t.Fatalf("Unexpected devices in range: %+v %v", devices, err)
+	}
+	devices, _ = q.DevicesInRange(hw("iPhone9,1"), hw("iPhone14,7"))
+	if len(devices) != 2 || devices[1].HardwareString != "iPhone14,7" {
+		t.Fatalf("Range bounds should be included: %+v", devices)
+	}
+	if _, err := q.DevicesInRange(hw("iPad1,1"), hw("iPhone15,4")); err == nil {
+		t.Fatalf("A range over several prefixes should be refused")
+	}
+}
+
+func TestResolveBuild(t *testing.T) {
+	q := testDB(t)
+
+	for build, expected := range map[string]string{
+		"21A341":   "17.0.1", // exact
+		"21A5248v": "17.0.0", // beta, before every known 17 build
+		"21A330":   "17.0.0", // between 17.0 and 17.0.1
+		"21A341a":  "17.0.1", // device-specific rebuild
+		"21G101":   "17.0.1", // newer than the db
+	} {
+		res, err := q.ResolveBuild(build)
+		if err != nil || res.Release.Version.String() != expected {
+			t.Fatalf("%s: expected %s, got %+v %v", build, expected, res, err)
+		}
+		if res.Exact != (build == "21A341") {
+			t.Fatalf("%s: unexpected exactness: %+v", build, res)
+		}
+	}
+	if _, err := q.ResolveBuild("19A346"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("A build of an unknown major version should not resolve, got %v", err)
+	}
+	if _, err := q.ResolveBuild("latest"); err == nil {
+		t.Fatalf("Expected an error on a non build number")
+	}
+}
+
+func TestReleasesIn(t *testing.T) {
+	q := testDB(t)
+
+	set, _ := version.ParseOSVersionSet(">=16.0 <17.0.1")
+	releases, err := q.ReleasesIn("ios", set)
+	if err != nil || len(releases) != 2 || releases[1].Version.String() != "17.0.0" || len(releases[1].Builds) != 1 {
+		t.Fatalf("Unexpected releases: %+v %v", releases, err)
+	}
+	releases, _ = q.ReleasesIn("ios", set.Complement())
+	if len(releases) != 1 || releases[0].Version.String() != "17.0.1" {
+		t.Fatalf("Unexpected releases: %+v", releases)
+	}
+}
+
+func TestReleasesWithDarwin(t *testing.T) {
+	q := testDB(t)
+
+	releases, err := q.ReleasesWithDarwin("ios", v("23.0.0"))
+	if err != nil || len(releases) != 2 || releases[0].Version.String() != "17.0.0" || releases[1].Darwin.String() != "23.0.0" {
+		t.Fatalf("Unexpected releases: %+v %v", releases, err)
+	}
+	if releases, _ := q.ReleasesWithDarwin("ios", v("23.1.0")); len(releases) != 0 {
+		t.Fatalf("Unexpected releases: %+v", releases)
+	}
+}
+
+func TestTimelines(t *testing.T) {
+	q := testDB(t)
+	timelines, err := q.Timelines("ios")
+	if err != nil || len(timelines) != 3 {
+		t.Fatalf("Unexpected timelines: %+v %v", timelines, err)
+	}
+	for i, expected := range []struct {
+		hardware, shipping, shippingDate, lastUpdate string
+		years                                        float64
+		droppedBy                                    int
+	}{
+		{"iPhone9,1", "16.0.0", "2022-09-12", "16.0.0", 0, 17},
+		{"iPhone14,7", "16.0.0", "2022-09-12", "17.0.0", 1.02, 0},
+		{"iPhone15,4", "17.0.0", "2023-09-18", "17.0.1", 0.01, 0},
+	} {
+		tl := timelines[i]
+		droppedBy := 0
+		if tl.DroppedBy != nil {
+			droppedBy = *tl.DroppedBy
+		}
+		if tl.Device.HardwareString != expected.hardware || tl.ShippingOS.String() != expected.shipping ||
+			tl.ShippingDate == nil || tl.ShippingDate.Format(version.ReleaseDateLayout) != expected.shippingDate ||
+			tl.LastUpdate.String() != expected.lastUpdate || tl.SupportYears == nil || *tl.SupportYears != expected.years ||
+			droppedBy != expected.droppedBy {
+			t.Fatalf("Unexpected timeline %d: %+v", i, tl)
+		}
+	}
+	if timelines[2].Device.Cpu == nil || timelines[2].Device.ModelName != "iPhone 15" {
+		t.Fatalf("Timelines should carry their device: %+v", timelines[2].Device)
+	}
+
+	tl, err := q.TimelineFor("ios", "iPhone14,7")
+	if err != nil || tl.LastMajor != 17 || tl.DroppedBy != nil {
+		t.Fatalf("Unexpected timeline: %+v %v", tl, err)
+	}
+	if _, err := q.TimelineFor("ios", "iPhone1,1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package render
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/version"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Group is a set of items sharing the same key, as returned by groupBy and
+// groupByFamily.
+type Group struct {
+	Key   string
+	Items []interface{}
+}
+
+// family returns the device family of a hardware string, e.g. "iPhone"
+// for "iPhone15,4".
+func family(hardwareString string) string {
+	return string(version.HardwareFamily(hardwareString))
+}
+
+func toVersion(v interface{}) (version.OSVersion, error) {
+	switch val := v.(type) {
+	case version.OSVersion:
+		return val, nil
+	case *dataset.Release:
+		return val.Version, nil
+	case string:
+		return version.OSVersionFromString(val)
+	}
+	return version.OSVersion{}, fmt.Errorf("cannot use %T as a version", v)
+}
+
+// versionCompare returns -1, 0 or 1 when a is older than, equal to or newer
+// than b. Both can be versions, releases or strings like "17.4".
+func versionCompare(a interface{}, b interface{}) (int, error) {
+	va, err := toVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := toVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	if va.Lt(vb) {
+		return -1, nil
+	}
+	if va.Gt(vb) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// field resolves a dotted field path ("Cpu.Label") on item, following
+// pointers. A nil pointer along the way yields an invalid value.
+func field(item reflect.Value, path string) reflect.Value {
+	for _, name := range strings.Split(path, ".") {
+		for item.Kind() == reflect.Ptr || item.Kind() == reflect.Interface {
+			if item.IsNil() {
+				return reflect.Value{}
+			}
+			item = item.Elem()
+		}
+		if item.Kind() != reflect.Struct {
+			return reflect.Value{}
+		}
+		item = item.FieldByName(name)
+		if !item.IsValid() {
+			return item
+		}
+	}
+	return item
+}
+
+// less orders two field values: versions by version, numbers numerically,
+// anything else by its string representation. Invalid values come first.
+func less(a reflect.Value, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return !a.IsValid() && b.IsValid()
+	}
+	if va, ok := a.Interface().(version.OSVersion); ok {
+		if vb, ok := b.Interface().(version.OSVersion); ok {
+			return va.Lt(vb)
+		}
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	}
+	return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+}
+
+func items(list interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("cannot iterate over %T", list)
+	}
+	out := make([]interface{}, v.Len())
+	for i := range out {
+		out[i] = v.Index(i).Interface()
+	}
+	return out, nil
+}
+
+func sortItems(path string, list interface{}, desc bool) ([]interface{}, error) {
+	out, err := items(list)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := field(reflect.ValueOf(out[i]), path), field(reflect.ValueOf(out[j]), path)
+		if desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+	return out, nil
+}
+
+// groupBy groups the items of list by the string representation of their
+// field path, groups being sorted by key and items keeping their order.
+func groupBy(path string, list interface{}) ([]Group, error) {
+	all, err := items(list)
+	if err != nil {
+		return nil, err
+	}
+	return group(all, func(item interface{}) string {
+		v := field(reflect.ValueOf(item), path)
+		if !v.IsValid() {
+			return ""
+		}
+		return fmt.Sprint(v.Interface())
+	}), nil
+}
+
+func group(all []interface{}, key func(interface{}) string) []Group {
+	var groups []Group
+	index := map[string]int{}
+	for _, item := range all {
+		k := key(item)
+		i, exists := index[k]
+		if !exists {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, Group{Key: k})
+		}
+		groups[i].Items = append(groups[i].Items, item)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
+
+// groupByFamily groups devices by family (iPhone, iPad, Watch...).
+func groupByFamily(devices []*dataset.Device) []Group {
+	all := make([]interface{}, len(devices))
+	for i, d := range devices {
+		all[i] = d
+	}
+	return group(all, func(item interface{}) string { return family(item.(*dataset.Device).Codename) })
+}
+
+// Funcs are the helpers available to templates, on top of the text/template
+// built-ins.
+var Funcs = template.FuncMap{
+	"versionCompare": versionCompare,
+	"parseVersion":   version.OSVersionFromString,
+	"sortBy":         func(path string, list interface{}) ([]interface{}, error) { return sortItems(path, list, false) },
+	"sortByDesc":     func(path string, list interface{}) ([]interface{}, error) { return sortItems(path, list, true) },
+	"groupBy":        groupBy,
+	"groupByFamily":  groupByFamily,
+	"family":         family,
+	"join":           strings.Join,
+	"lower":          strings.ToLower,
+	"upper":          strings.ToUpper,
+	"trim":           strings.TrimSpace,
+	"replace":        func(old string, new string, s string) string { return strings.ReplaceAll(s, old, new) },
+	"sqlQuote":       func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" },
+}
+
+// Render executes the template text against ds and writes the result to w.
+// Templates see ds as dot: .Devices, .Processors and .Releases.
+func Render(w io.Writer, name string, text string, ds *dataset.Dataset) error {
+	tmpl, err := template.New(name).Funcs(Funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, ds)
+}
@@ -0,0 +1,55 @@
+package render
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/version"
+	"bytes"
+	"testing"
+)
+
+func testDataset() *dataset.Dataset {
+	a16 := &dataset.Processor{Code: "A16_Bionic", Label: "A16 Bionic"}
+	m2 := &dataset.Processor{Code: "M2", Label: "M2"}
+	v17, _ := version.OSVersionFromString("17.0")
+	v1710, _ := version.OSVersionFromString("17.10")
+	r17 := &dataset.Release{Family: "ios", Version: v17, Builds: []string{"21A329"}}
+	r1710 := &dataset.Release{Family: "ios", Version: v1710}
+	iphone := &dataset.Device{Codename: "iPhone15,4", Modelname: "iPhone 15", Cpu: a16, Releases: []*dataset.Release{r17, r1710}}
+	ipad := &dataset.Device{Codename: "iPad14,3", Modelname: "iPad Pro 11-inch (4th generation)", Cpu: m2, Releases: []*dataset.Release{r17}}
+	watch := &dataset.Device{Codename: "Watch7,1", Modelname: "Apple Watch Series 9"}
+	r17.Devices = []*dataset.Device{ipad, iphone}
+	r1710.Devices = []*dataset.Device{iphone}
+	return &dataset.Dataset{
+		Processors: []*dataset.Processor{a16, m2},
+		Releases:   []*dataset.Release{r17, r1710},
+		Devices:    []*dataset.Device{ipad, iphone, watch},
+	}
+}
+
+func TestRender(t *testing.T) {
+	cases := map[string]string{
+		// grouping, with devices in their original order
+		`{{range groupByFamily .Devices}}{{.Key}}:{{range .Items}} {{.Codename}}{{end}};{{end}}`: "Watch: Watch7,1;iPad: iPad14,3;iPhone: iPhone15,4;",
+		// sorting on nested fields, with nil pointers first
+		`{{range sortByDesc "Cpu.Label" .Devices}}{{.Modelname}}|{{end}}`: "iPad Pro 11-inch (4th generation)|iPhone 15|Apple Watch Series 9|",
+		// versions sort numerically, not lexically
+		`{{range sortByDesc "Version" .Releases}}{{.Version}} {{end}}`:                   "17.10.0 17.0.0 ",
+		`{{versionCompare "17.2" (index .Releases 1)}} {{versionCompare "17" "17.0.0"}}`: "-1 0",
+		`{{range (index .Releases 0).Devices}}{{.Codename}} {{end}}`:                     "iPad14,3 iPhone15,4 ",
+		`{{range .Devices}}INSERT INTO t VALUES ({{sqlQuote .Modelname}});{{end}}`:       "INSERT INTO t VALUES ('iPad Pro 11-inch (4th generation)');INSERT INTO t VALUES ('iPhone 15');INSERT INTO t VALUES ('Apple Watch Series 9');",
+		`{{range groupBy "Cpu.Code" .Devices}}[{{.Key}}]{{len .Items}}{{end}}`:           "[]1[A16_Bionic]1[M2]1",
+	}
+	for tmpl, expected := range cases {
+		var out bytes.Buffer
+		if err := Render(&out, "test", tmpl, testDataset()); err != nil {
+			t.Fatalf("%s: %s", tmpl, err.Error())
+		}
+		if out.String() != expected {
+			t.Fatalf("%s: expected %q, got %q", tmpl, expected, out.String())
+		}
+	}
+	var out bytes.Buffer
+	if err := Render(&out, "bad", `{{versionCompare "x" "1"}}`, testDataset()); err == nil {
+		t.Fatalf("Invalid versions should make rendering fail")
+	}
+}
@@ -0,0 +1,207 @@
+// Package resolve turns raw User-Agent strings and machine identifiers
+// (`sysctl hw.machine`, e.g. "iPhone15,4") into the device and OS release
+// they designate in a generated DB.
+package resolve
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/version"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var ErrNoMatch = errors.New("neither an OS version nor a hardware string found")
+
+var (
+	// Safari: "CPU iPhone OS 17_4 like Mac OS X", "CPU OS 17_4_1 like Mac OS X"
+	// apps: "iOS 17.4", "iOS/17.4.1", "iPadOS 17.4", "iPhone OS 17.4"
+	osRegex = regexp.MustCompile(`(?:CPU (?:iPhone )?OS|iPhone OS|iPadOS|iOS)[ /](\d+(?:[._]\d+){0,2})\b`)
+	// "(iPhone;", "(iPad;", "(iPod touch;"
+	platformRegex = regexp.MustCompile(`\((iPhone|iPad|iPod)[ ;]`)
+)
+
+// UserAgent is what can be told from a User-Agent string alone.
+type UserAgent struct {
+	Platform       string             // iPhone, iPad or iPod, empty when unknown
+	HardwareString string             // only sent by some apps, empty otherwise
+	OSVersion      *version.OSVersion // nil when the User-Agent has none
+	// Darwin is the kernel version sent by CFNetwork User-Agents, e.g.
+	// "Darwin/23.4.0", nil when the User-Agent has none
+	Darwin *version.OSVersion
+}
+
+// IsHardwareString tells whether s is a bare machine identifier, e.g.
+// "iPhone15,4".
+func IsHardwareString(s string) bool {
+	_, err := version.HardwareIdentifierFromString(s)
+	return err == nil
+}
+
+// ParseUserAgent extracts the platform, OS version, Darwin version and
+// hardware string of an iOS or iPadOS Safari or app User-Agent.
+func ParseUserAgent(ua string) (UserAgent, error) {
+	var out UserAgent
+	if m := platformRegex.FindStringSubmatch(ua); m != nil {
+		out.Platform = m[1]
+	}
+	if found := version.FindHardwareIdentifiers(ua); len(found) > 0 {
+		out.HardwareString = found[0].String()
+		if out.Platform == "" {
+			out.Platform = string(found[0].Family())
+		}
+	}
+	if m := osRegex.FindStringSubmatch(ua); m != nil {
+		v, err := version.OSVersionFromString(strings.ReplaceAll(m[1], "_", "."))
+		if err != nil {
+			return out, err
+		}
+		out.OSVersion = &v
+	}
+	out.Darwin = version.FindDarwinVersion(ua)
+	if out.OSVersion == nil && out.Darwin == nil && out.HardwareString == "" {
+		return out, ErrNoMatch
+	}
+	return out, nil
+}
+
+type Processor struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+}
+
+// Result is the resolution of a User-Agent and/or a hardware string
+// against a DB. Fields that cannot be told are left empty or nil.
+type Result struct {
+	UserAgent      string     `json:"user_agent,omitempty"`
+	Platform       string     `json:"platform,omitempty"`
+	HardwareString string     `json:"hardware_string,omitempty"`
+	ModelName      string     `json:"model_name,omitempty"`
+	Cpu            *Processor `json:"cpu"`
+	OSVersion      string     `json:"os_version,omitempty"`
+	// Darwin is the kernel version sent by the User-Agent. When it has no
+	// OS version, OSVersion is derived from Darwin: the earliest release
+	// of the DB running it, or else version.DarwinToIOS.
+	Darwin string `json:"darwin,omitempty"`
+	// OSKnown tells whether OSVersion is a release listed in the DB.
+	OSKnown bool `json:"os_known"`
+	// OSSupported tells whether the device can run OSVersion, nil when
+	// either is unknown.
+	OSSupported *bool `json:"os_supported"`
+	// LatestOS is the latest release the device can run, or the latest
+	// release of the DB when the device is unknown.
+	LatestOS string `json:"latest_os,omitempty"`
+}
+
+// Resolver answers from a dataset. It is safe for concurrent use.
+type Resolver struct {
+	ds      *dataset.Dataset
+	devices map[string]*dataset.Device
+}
+
+func New(ds *dataset.Dataset) *Resolver {
+	r := &Resolver{ds: ds, devices: map[string]*dataset.Device{}}
+	for _, d := range ds.Devices {
+		r.devices[d.Codename] = d
+	}
+	return r
+}
+
+func (r *Resolver) latest() *version.OSVersion {
+	var latest *version.OSVersion
+	for _, rel := range r.ds.Releases {
+		if rel.Family == "ios" && (latest == nil || rel.Version.Gt(*latest)) {
+			latest = &rel.Version
+		}
+	}
+	return latest
+}
+
+// fromDarwin returns the iOS version running Darwin version d.
+func (r *Resolver) fromDarwin(d version.OSVersion) *version.OSVersion {
+	var earliest *version.OSVersion
+	for _, rel := range r.ds.Releases {
+		if rel.Family == "ios" && rel.Darwin != nil && rel.Darwin.Eq(d) && (earliest == nil || rel.Version.Lt(*earliest)) {
+			earliest = &rel.Version
+		}
+	}
+	if earliest != nil {
+		return earliest
+	}
+	if v, err := version.DarwinToIOS(d); err == nil {
+		return &v
+	}
+	return nil
+}
+
+func (r *Resolver) known(v version.OSVersion) bool {
+	for _, rel := range r.ds.Releases {
+		if rel.Version.Eq(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve resolves a User-Agent, a hardware string or both; machine takes
+// precedence over a hardware string found in ua. A device missing from the
+// DB is not an error: its fields are just left empty.
+func (r *Resolver) Resolve(ua string, machine string) (Result, error) {
+	res := Result{UserAgent: ua}
+	var osver *version.OSVersion
+	if ua != "" {
+		parsed, err := ParseUserAgent(ua)
+		if err != nil {
+			return res, err
+		}
+		res.Platform = parsed.Platform
+		res.HardwareString = parsed.HardwareString
+		osver = parsed.OSVersion
+		if parsed.Darwin != nil {
+			res.Darwin = parsed.Darwin.String()
+			if osver == nil {
+				osver = r.fromDarwin(*parsed.Darwin)
+			}
+		}
+	}
+	if machine != "" {
+		if !IsHardwareString(machine) {
+			return res, errors.New("not a hardware string: " + machine)
+		}
+		res.HardwareString = machine
+		res.Platform = string(version.HardwareFamily(machine))
+	}
+	if ua == "" && machine == "" {
+		return res, ErrNoMatch
+	}
+	if osver != nil {
+		res.OSVersion = osver.String()
+		res.OSKnown = r.known(*osver)
+	}
+	latest := r.latest()
+	if d, ok := r.devices[res.HardwareString]; ok {
+		res.ModelName = d.Modelname
+		if d.Cpu != nil {
+			res.Cpu = &Processor{Code: d.Cpu.Code, Label: d.Cpu.Label}
+		}
+		latest = d.MaxOS()
+		if osver != nil && latest != nil {
+			supported := osver.Gte(*d.MinOS()) && osver.Lte(*latest)
+			res.OSSupported = &supported
+		}
+	}
+	if latest != nil {
+		res.LatestOS = latest.String()
+	}
+	return res, nil
+}
+
+// ResolveLine resolves a single input line of a batch, being either a
+// bare hardware string or a User-Agent.
+func (r *Resolver) ResolveLine(line string) (Result, error) {
+	line = strings.TrimSpace(line)
+	if IsHardwareString(line) {
+		return r.Resolve("", line)
+	}
+	return r.Resolve(line, "")
+}
@@ -0,0 +1,115 @@
+package resolve
+
+import (
+	"appledata/Packages/dataset"
+	"appledata/Packages/dbtools"
+	"appledata/Packages/version"
+	"path"
+	"testing"
+)
+
+func v(s string) version.OSVersion {
+	ver, _ := version.OSVersionFromString(s)
+	return ver
+}
+
+func testResolver(t *testing.T) *Resolver {
+	dbfile := path.Join(t.TempDir(), dbtools.DB_NAME)
+	s, err := dbtools.NewSQLStore(dbfile, dbtools.Options{})
+	if err != nil {
+		t.Fatalf("NewSQLStore: %s", err.Error())
+	}
+	s.UpdateCPU("A16_Bionic", "A16 Bionic")
+	for ver, builds := range map[string][]string{"16.0": {"20A362"}, "17.0": {"21A329"}, "17.4": {"21E219"}} {
+		bn, _ := version.BuildNumberFromString(builds[0])
+		darwin, _ := version.IOSToDarwin(v(ver))
+		s.AddIOSVersion(version.IOSVersion{Version: v(ver), Builds: []version.BuildNumber{bn}, Darwin: &darwin})
+	}
+	s.AddDevice("iPhone 15", "iPhone15,4", "Apple A16 Bionic", v("17.0"), v("17.4"))
+	s.AddDevice("iPhone 14", "iPhone14,7", "Apple A15 Bionic", v("16.0"), v("17.0"))
+	if err := s.Flush(dbtools.BuildMetadata{Mode: "generate"}); err != nil {
+		t.Fatalf("Flush: %s", err.Error())
+	}
+	ds, err := dataset.LoadFile(dbfile)
+	if err != nil {
+		t.Fatalf("LoadFile: %s", err.Error())
+	}
+	return New(ds)
+}
+
+func TestParseUserAgent(t *testing.T) {
+	for ua, expected := range map[string]UserAgent{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1": {Platform: "iPhone", OSVersion: &version.OSVersion{X: 17, Y: 4}},
+		"Mozilla/5.0 (iPad; CPU OS 16_6_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1":        {Platform: "iPad", OSVersion: &version.OSVersion{X: 16, Y: 6, Z: 1}},
+		"Mozilla/5.0 (iPod touch; CPU iPhone OS 15_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148":                       {Platform: "iPod", OSVersion: &version.OSVersion{X: 15, Y: 7}},
+		"MyApp/2.1 (com.example.app; build:42; iPhone15,4; iOS 17.4.1) Alamofire/5.8.0":                                                           {Platform: "iPhone", HardwareString: "iPhone15,4", OSVersion: &version.OSVersion{X: 17, Y: 4, Z: 1}},
+		"Reader/1.0 (iPad13,18; iPadOS/17.0; Scale/2.00)":                                                                                         {Platform: "iPad", HardwareString: "iPad13,18", OSVersion: &version.OSVersion{X: 17}},
+	} {
+		parsed, err := ParseUserAgent(ua)
+		if err != nil {
+			t.Fatalf("%s: %s", ua, err.Error())
+		}
+		if parsed.Platform != expected.Platform || parsed.HardwareString != expected.HardwareString || !parsed.OSVersion.Eq(*expected.OSVersion) {
+			t.Fatalf("%s: expected %+v, got %+v", ua, expected, parsed)
+		}
+	}
+	parsed, err := ParseUserAgent("MyApp/42 CFNetwork/1494.0.7 Darwin/23.4.0")
+	if err != nil || parsed.OSVersion != nil || parsed.Darwin == nil || parsed.Darwin.String() != "23.4.0" {
+		t.Fatalf("Unexpected CFNetwork User-Agent parsing: %+v %v", parsed, err)
+	}
+	if _, err := ParseUserAgent("Mozilla/5.0 (X11; Linux x86_64) Firefox/124.0"); err != ErrNoMatch {
+		t.Fatalf("Expected ErrNoMatch, got %v", err)
+	}
+	parsed, err = ParseUserAgent("MyApp/2.1 (MacBookPro18,3; macOS 14.4) CFNetwork/1494.0.7 Darwin/23.4.0")
+	if err != nil || parsed.HardwareString != "MacBookPro18,3" || parsed.Platform != string(version.FamilyMac) {
+		t.Fatalf("Unexpected Mac User-Agent parsing: %+v %v", parsed, err)
+	}
+}
+
+func TestIsHardwareString(t *testing.T) {
+	for s, expected := range map[string]bool{
+		"iPhone15,4": true, "MacBookPro18,3": true, "iMac21,1": true, "Macmini9,1": true, "AudioAccessory5,1": true,
+		"iPhone15": false, "Foo1,1": false, "iPhone0,1": false, " iPhone15,4": false, "iPhone15,4 ": false,
+	} {
+		if IsHardwareString(s) != expected {
+			t.Fatalf("IsHardwareString(%q) should be %v", s, expected)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := testResolver(t)
+
+	res, err := r.Resolve("Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) Mobile/15E148", "iPhone14,7")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if res.ModelName != "iPhone 14" || res.Cpu != nil || res.OSVersion != "17.4.0" || !res.OSKnown || res.OSSupported == nil || *res.OSSupported || res.LatestOS != "17.0.0" {
+		t.Fatalf("Unexpected result: %+v", res)
+	}
+	res, _ = r.ResolveLine("MyApp/2.1 (iPhone15,4; iOS 17.0)")
+	if res.ModelName != "iPhone 15" || res.Cpu.Code != "A16_Bionic" || !*res.OSSupported || res.LatestOS != "17.4.0" {
+		t.Fatalf("Unexpected result: %+v", res)
+	}
+	res, _ = r.ResolveLine("iPhone15,4")
+	if res.Platform != "iPhone" || res.ModelName != "iPhone 15" || res.OSSupported != nil {
+		t.Fatalf("Unexpected result: %+v", res)
+	}
+	// Safari does not tell the model: only the OS can be checked
+	res, _ = r.ResolveLine("Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X)")
+	if res.ModelName != "" || res.OSKnown || res.OSSupported != nil || res.LatestOS != "17.4.0" {
+		t.Fatalf("Unexpected result: %+v", res)
+	}
+	// CFNetwork only tells the Darwin version
+	res, _ = r.ResolveLine("MyApp/42 CFNetwork/1494.0.7 Darwin/23.4.0")
+	if res.Darwin != "23.4.0" || res.OSVersion != "17.4.0" || !res.OSKnown {
+		t.Fatalf("Unexpected result: %+v", res)
+	}
+	res, _ = r.ResolveLine("MyApp/42 CFNetwork/1496.0.7 Darwin/23.5.0")
+	if res.OSVersion != "17.5.0" || res.OSKnown {
+		t.Fatalf("Unexpected result: %+v", res)
+	}
+	if _, err := r.Resolve("", "iPhone 15"); err == nil {
+		t.Fatalf("A model name is not a hardware string")
+	}
+}
@@ -0,0 +1,116 @@
+package version
+
+import (
+	"fmt"
+)
+
+// BetaBuildThreshold is the build component from which a build is a beta
+// or seed: Apple adds 5000 (sometimes 7000 or 9000) to the build of
+// prerelease builds, e.g. 21A5248v for a 17.0 beta.
+const BetaBuildThreshold = 5000
+
+// IsBeta tells whether b is a prerelease build.
+func (b BuildNumber) IsBeta() bool {
+	return b.Build >= BetaBuildThreshold
+}
+
+// Compare returns -1, 0 or 1 when b was built before, like or after rhs:
+// by major number, minor letter, then build and patch letter. Betas of a
+// release always come before its final builds, whatever their build
+// component.
+func (b BuildNumber) Compare(rhs BuildNumber) int {
+	switch {
+	case b.Major != rhs.Major:
+		return sign(b.Major - rhs.Major)
+	case b.Minor != rhs.Minor:
+		if b.Minor < rhs.Minor {
+			return -1
+		}
+		return 1
+	case b.IsBeta() != rhs.IsBeta():
+		if b.IsBeta() {
+			return -1
+		}
+		return 1
+	case b.Build != rhs.Build:
+		return sign(b.Build - rhs.Build)
+	case b.Patch != rhs.Patch:
+		if b.Patch < rhs.Patch {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func (b BuildNumber) Eq(rhs BuildNumber) bool {
+	return b.Compare(rhs) == 0
+}
+func (b BuildNumber) Lt(rhs BuildNumber) bool {
+	return b.Compare(rhs) < 0
+}
+func (b BuildNumber) Lte(rhs BuildNumber) bool {
+	return b.Compare(rhs) <= 0
+}
+func (b BuildNumber) Gt(rhs BuildNumber) bool {
+	return b.Compare(rhs) > 0
+}
+func (b BuildNumber) Gte(rhs BuildNumber) bool {
+	return b.Compare(rhs) >= 0
+}
+
+// iOS release trains, by major version
+var iosTrains = map[int]string{
+	1:  "Alpine",
+	2:  "Big Bear",
+	3:  "Kirkwood",
+	4:  "Apex",
+	5:  "Telluride",
+	6:  "Sundance",
+	7:  "Innsbruck",
+	8:  "Okemo",
+	9:  "Monarch",
+	10: "Whitetail",
+	11: "Tigris",
+	12: "Peace",
+	13: "Yukon",
+	14: "Azul",
+	15: "Sky",
+	16: "Sydney",
+	17: "Dawn",
+	18: "Crystal",
+	26: "Luck",
+}
+
+// IOSMajor infers the iOS major version b belongs to from its major
+// number: 1 to 4 for iOS 1, 5 for iOS 2, then major number - 4 from iOS 3
+// (7A341) to iOS 18 (22A3354). Build numbers, like Darwin versions, did not
+// follow the jump from iOS 18 to 26: major number + 3 from iOS 26 (23A341)
+// on.
+func (b BuildNumber) IOSMajor() (int, error) {
+	switch {
+	case b.Major >= 1 && b.Major <= 4:
+		return 1, nil
+	case b.Major == 5:
+		return 2, nil
+	case b.Major >= 23:
+		return b.Major + 3, nil
+	case b.Major >= 7:
+		return b.Major - 4, nil
+	}
+	return 0, fmt.Errorf("build %s: no iOS release uses major number %d", b.String(), b.Major)
+}
+
+// Train returns the name of the release train of the iOS major version b
+// belongs to, e.g. "Dawn" for 21A329 (iOS 17).
+func (b BuildNumber) Train() (string, error) {
+	major, err := b.IOSMajor()
+	if err != nil {
+		return "", err
+	}
+	train, ok := iosTrains[major]
+	if !ok {
+		return "", fmt.Errorf("build %s: unknown train for iOS %d", b.String(), major)
+	}
+	return train, nil
+}
@@ -0,0 +1,107 @@
+package version
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Darwin major versions of the iOS major versions, from iOS 9 on (earlier
+// majors do not map one to one: iOS 7 and 8 both run Darwin 14). iOS
+// skipped from 18 to 26, Darwin did not.
+var iosDarwinMajors = map[int]int{
+	9:  15,
+	10: 16,
+	11: 17,
+	12: 18,
+	13: 19,
+	14: 20,
+	15: 21,
+	16: 22,
+	17: 23,
+	18: 24,
+	26: 25,
+}
+
+func invert(m map[int]int) map[int]int {
+	out := map[int]int{}
+	for k, v := range m {
+		out[v] = k
+	}
+	return out
+}
+
+var darwinIOSMajors = invert(iosDarwinMajors)
+
+// IOSToDarwin returns the Darwin version of iOS version v. Darwin minor
+// versions follow iOS minor versions for most releases, e.g. iOS 17.4 runs
+// Darwin 23.4.0, but not all of them (iOS 15.7 runs Darwin 21.6.0): prefer
+// the darwin_version column of the DB for known releases.
+func IOSToDarwin(v OSVersion) (OSVersion, error) {
+	major, ok := iosDarwinMajors[v.X]
+	if !ok {
+		return OSVersion{}, fmt.Errorf("no known Darwin version for iOS %d", v.X)
+	}
+	return OSVersion{X: major, Y: v.Y}, nil
+}
+
+// DarwinToIOS returns the iOS version running Darwin version d, with the
+// same caveat as IOSToDarwin: the patch version cannot be told.
+func DarwinToIOS(d OSVersion) (OSVersion, error) {
+	major, ok := darwinIOSMajors[d.X]
+	if !ok {
+		return OSVersion{}, fmt.Errorf("no known iOS version for Darwin %d", d.X)
+	}
+	return OSVersion{X: major, Y: d.Y}, nil
+}
+
+// MacOSToDarwin returns the Darwin major version of macOS version v: Mac OS
+// X 10.5 to 10.15 run Darwin 9 to 19, macOS 11 to 15 Darwin 20 to 24 and
+// macOS 26 Darwin 25. Minor versions do not follow a rule on macOS.
+func MacOSToDarwin(v OSVersion) (OSVersion, error) {
+	switch {
+	case v.X == 10 && v.Y >= 5 && v.Y <= 15:
+		return OSVersion{X: v.Y + 4}, nil
+	case v.X >= 11 && v.X <= 15:
+		return OSVersion{X: v.X + 9}, nil
+	case v.X == 26:
+		return OSVersion{X: 25}, nil
+	}
+	return OSVersion{}, fmt.Errorf("no known Darwin version for macOS %d.%d", v.X, v.Y)
+}
+
+// DarwinToMacOS is the inverse of MacOSToDarwin: it returns the macOS major
+// version (X.Y for Mac OS X) running Darwin version d.
+func DarwinToMacOS(d OSVersion) (OSVersion, error) {
+	switch {
+	case d.X >= 9 && d.X <= 19:
+		return OSVersion{X: 10, Y: d.X - 4}, nil
+	case d.X >= 20 && d.X <= 24:
+		return OSVersion{X: d.X - 9}, nil
+	case d.X == 25:
+		return OSVersion{X: 26}, nil
+	}
+	return OSVersion{}, fmt.Errorf("no known macOS version for Darwin %d", d.X)
+}
+
+var (
+	darwinRegex       = regexp.MustCompile(`\bDarwin[/ ]([0-9]+(?:\.[0-9]+){0,2})\b`)
+	darwinKernelRegex = regexp.MustCompile(`\bDarwin Kernel Version ([0-9]+(?:\.[0-9]+){0,2})\b`)
+)
+
+// FindDarwinVersion returns the Darwin version reported in text, e.g. by a
+// CFNetwork User-Agent ("CFNetwork/1494.0.7 Darwin/23.4.0") or a crash log
+// ("Darwin Kernel Version 23.4.0"), nil when there is none.
+func FindDarwinVersion(text string) *OSVersion {
+	m := darwinRegex.FindStringSubmatch(text)
+	if m == nil {
+		m = darwinKernelRegex.FindStringSubmatch(text)
+	}
+	if m == nil {
+		return nil
+	}
+	v, err := ParseOSVersion(m[1])
+	if err != nil {
+		return nil
+	}
+	return &v
+}
@@ -0,0 +1,170 @@
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// DeviceFamily is the kind of device a hardware identifier designates.
+type DeviceFamily string
+
+const (
+	FamilyIPhone         DeviceFamily = "iPhone"
+	FamilyIPad           DeviceFamily = "iPad"
+	FamilyIPod           DeviceFamily = "iPod"
+	FamilyWatch          DeviceFamily = "Watch"
+	FamilyAppleTV        DeviceFamily = "AppleTV"
+	FamilyMac            DeviceFamily = "Mac"
+	FamilyAudioAccessory DeviceFamily = "AudioAccessory"
+	FamilyRealityDevice  DeviceFamily = "RealityDevice"
+)
+
+// DeviceFamilies lists every family, in the order hardware identifiers
+// are sorted by.
+var DeviceFamilies = []DeviceFamily{FamilyIPhone, FamilyIPad, FamilyIPod, FamilyWatch, FamilyAppleTV, FamilyMac, FamilyAudioAccessory, FamilyRealityDevice}
+
+// hardware identifier prefixes and the family they belong to: Macs use
+// one prefix per product line
+var hardwarePrefixes = map[string]DeviceFamily{
+	"iPhone":         FamilyIPhone,
+	"iPad":           FamilyIPad,
+	"iPod":           FamilyIPod,
+	"Watch":          FamilyWatch,
+	"AppleTV":        FamilyAppleTV,
+	"Mac":            FamilyMac,
+	"MacBook":        FamilyMac,
+	"MacBookAir":     FamilyMac,
+	"MacBookPro":     FamilyMac,
+	"Macmini":        FamilyMac,
+	"MacPro":         FamilyMac,
+	"iMac":           FamilyMac,
+	"iMacPro":        FamilyMac,
+	"AudioAccessory": FamilyAudioAccessory,
+	"RealityDevice":  FamilyRealityDevice,
+}
+
+var hardwareRegex = regexp.MustCompile(`^([A-Za-z]+)([0-9]+),([0-9]+)$`)
+var hardwareSearchRegex = regexp.MustCompile(`\b([A-Za-z]+)([0-9]+),([0-9]+)\b`)
+
+// HardwareIdentifier is a machine identifier as returned by
+// `sysctl hw.machine`, e.g. iPhone14,2: a product line prefix, a major
+// number (roughly the hardware generation) and a minor number (the model
+// within that generation).
+type HardwareIdentifier struct {
+	Prefix string
+	Major  int
+	Minor  int
+}
+
+func (h HardwareIdentifier) String() string {
+	return fmt.Sprintf("%s%d,%d", h.Prefix, h.Major, h.Minor)
+}
+
+// Family returns the family of the identifier, empty for unknown prefixes.
+func (h HardwareIdentifier) Family() DeviceFamily {
+	return hardwarePrefixes[h.Prefix]
+}
+
+// Validate tells why h is not a hardware identifier Apple could ship, if
+// so.
+func (h HardwareIdentifier) Validate() error {
+	if _, ok := hardwarePrefixes[h.Prefix]; !ok {
+		return fmt.Errorf("unknown hardware identifier prefix %q", h.Prefix)
+	}
+	if h.Major < 1 {
+		return fmt.Errorf("%s: major number must be at least 1", h.String())
+	}
+	if h.Minor < 1 {
+		return fmt.Errorf("%s: minor number must be at least 1", h.String())
+	}
+	return nil
+}
+
+func familyRank(f DeviceFamily) int {
+	for i, family := range DeviceFamilies {
+		if family == f {
+			return i
+		}
+	}
+	return len(DeviceFamilies)
+}
+
+// Compare returns -1, 0 or 1 when h sorts before, like or after rhs:
+// by family, then prefix, then major and minor numbers.
+func (h HardwareIdentifier) Compare(rhs HardwareIdentifier) int {
+	switch {
+	case familyRank(h.Family()) != familyRank(rhs.Family()):
+		return sign(familyRank(h.Family()) - familyRank(rhs.Family()))
+	case h.Prefix != rhs.Prefix:
+		if h.Prefix < rhs.Prefix {
+			return -1
+		}
+		return 1
+	case h.Major != rhs.Major:
+		return sign(h.Major - rhs.Major)
+	}
+	return sign(h.Minor - rhs.Minor)
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func (h HardwareIdentifier) Eq(rhs HardwareIdentifier) bool {
+	return h.Compare(rhs) == 0
+}
+func (h HardwareIdentifier) Lt(rhs HardwareIdentifier) bool {
+	return h.Compare(rhs) < 0
+}
+
+func hardwareIdentifierFromMatch(m []string) (HardwareIdentifier, error) {
+	major, err := strconv.Atoi(m[2])
+	if err != nil {
+		return HardwareIdentifier{}, fmt.Errorf("%s: bad major number: %w", m[0], err)
+	}
+	minor, err := strconv.Atoi(m[3])
+	if err != nil {
+		return HardwareIdentifier{}, fmt.Errorf("%s: bad minor number: %w", m[0], err)
+	}
+	h := HardwareIdentifier{Prefix: m[1], Major: major, Minor: minor}
+	return h, h.Validate()
+}
+
+// HardwareIdentifierFromString parses a whole hardware identifier, e.g.
+// "iPhone14,2".
+func HardwareIdentifierFromString(s string) (HardwareIdentifier, error) {
+	m := hardwareRegex.FindStringSubmatch(s)
+	if m == nil {
+		return HardwareIdentifier{}, fmt.Errorf("%q is not a hardware identifier like iPhone14,2", s)
+	}
+	return hardwareIdentifierFromMatch(m)
+}
+
+// FindHardwareIdentifiers returns, in order of appearance, the valid
+// hardware identifiers found in text.
+func FindHardwareIdentifiers(text string) []HardwareIdentifier {
+	var out []HardwareIdentifier
+	for _, m := range hardwareSearchRegex.FindAllStringSubmatch(text, -1) {
+		if h, err := hardwareIdentifierFromMatch(m); err == nil {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// HardwareFamily returns the family of a hardware identifier string, empty
+// when it cannot be parsed.
+func HardwareFamily(s string) DeviceFamily {
+	h, err := HardwareIdentifierFromString(s)
+	if err != nil {
+		return ""
+	}
+	return h.Family()
+}
@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dlclark/regexp2"
 )
 
 type BuildNumber struct {
-	Major int // two digits
+	Major int // one or two digits
 	Minor string // one uppercase letter
 	Build int // variable number of digits
 	Patch string // optional, one lowercase letter
@@ -18,15 +19,19 @@ type BuildNumber struct {
 
 // BuildNumber string
 func (b BuildNumber) String() string {
-	return fmt.Sprintf("%02d%s%d%s", b.Major, b.Minor, b.Build, b.Patch)
+	return fmt.Sprintf("%d%s%d%s", b.Major, b.Minor, b.Build, b.Patch)
 }
 type IOSVersion struct {
 	Version OSVersion
 	Builds []BuildNumber
+	// Darwin is the kernel version of the release, nil when unknown
+	Darwin *OSVersion
+	// Released is the release date (UTC midnight), nil when unknown
+	Released *time.Time
 }
 
 func BuildNumberFromString(buildNumber string) (BuildNumber, error) {
-	bnregex, err := regexp2.Compile(`(?<major>[0-9]{2})(?<minor>[A-Z])(?<build>[0-9]+)(?<patch>[a-z])?`, regexp2.None)
+	bnregex, err := regexp2.Compile(`(?<major>[0-9]{1,2})(?<minor>[A-Z])(?<build>[0-9]+)(?<patch>[a-z])?`, regexp2.None)
 	if err != nil {
 		return BuildNumber{}, err
 	}
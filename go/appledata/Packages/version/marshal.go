@@ -0,0 +1,235 @@
+package version
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version components are stored in a single integer column as
+// X*osVersionScale² + Y*osVersionScale + Z, which sorts like the versions
+// themselves as long as Y and Z stay below osVersionScale.
+const osVersionScale = 1000
+
+// MarshalText prints o in canonical X.Y.Z form.
+func (o OSVersion) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText parses a version as ParseOSVersion does.
+func (o *OSVersion) UnmarshalText(text []byte) error {
+	v, err := ParseOSVersion(string(text))
+	if err != nil {
+		return err
+	}
+	*o = v
+	return nil
+}
+
+// Value stores o as a single sortable integer, e.g. 17004001 for 17.4.1.
+func (o OSVersion) Value() (driver.Value, error) {
+	if o.X < 0 || o.Y < 0 || o.Z < 0 || o.Y >= osVersionScale || o.Z >= osVersionScale {
+		return nil, fmt.Errorf("version %s cannot be stored: components must be within [0,%d)", o.String(), osVersionScale)
+	}
+	return int64(o.X)*osVersionScale*osVersionScale + int64(o.Y)*osVersionScale + int64(o.Z), nil
+}
+
+// Scan reads a version stored by Value. Text columns holding X.Y.Z
+// versions are accepted as well.
+func (o *OSVersion) Scan(src interface{}) error {
+	switch val := src.(type) {
+	case int64:
+		if val < 0 {
+			return fmt.Errorf("bad stored version %d", val)
+		}
+		*o = OSVersion{X: int(val / (osVersionScale * osVersionScale)), Y: int(val / osVersionScale % osVersionScale), Z: int(val % osVersionScale)}
+		return nil
+	case []byte:
+		return o.scanText(string(val))
+	case string:
+		return o.scanText(val)
+	case nil:
+		*o = OSVersion{}
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into a version", src)
+}
+
+func (o *OSVersion) scanText(s string) error {
+	if !strings.Contains(s, ".") {
+		// some drivers return integers as text
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return o.Scan(n)
+		}
+	}
+	return o.UnmarshalText([]byte(s))
+}
+
+// GormDataType is the column type of versions in GORM models.
+func (OSVersion) GormDataType() string {
+	return "bigint"
+}
+
+// MarshalText prints b as Apple does, e.g. "21A5248v", and the zero
+// build as an empty string.
+func (b BuildNumber) MarshalText() ([]byte, error) {
+	if b == (BuildNumber{}) {
+		return []byte{}, nil
+	}
+	if b.Minor == "" {
+		return nil, fmt.Errorf("build %s has no minor letter", b.String())
+	}
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText parses a whole build number: unlike BuildNumberFromString
+// it rejects surrounding text, so that the value prints back unchanged.
+func (b *BuildNumber) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*b = BuildNumber{}
+		return nil
+	}
+	parsed, err := BuildNumberFromString(string(text))
+	if err != nil || parsed.String() != string(text) {
+		return fmt.Errorf("%q is not a build number like 21A329", string(text))
+	}
+	*b = parsed
+	return nil
+}
+
+// Value stores b as its text form, the zero build as NULL. Use Compare
+// to order builds: their text form does not sort.
+func (b BuildNumber) Value() (driver.Value, error) {
+	if b == (BuildNumber{}) {
+		return nil, nil
+	}
+	text, err := b.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return string(text), nil
+}
+
+func (b *BuildNumber) Scan(src interface{}) error {
+	switch val := src.(type) {
+	case []byte:
+		return b.UnmarshalText(val)
+	case string:
+		return b.UnmarshalText([]byte(val))
+	case nil:
+		*b = BuildNumber{}
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into a build number", src)
+}
+
+func (BuildNumber) GormDataType() string {
+	return "string"
+}
+
+var iosVersionTextRegex = regexp.MustCompile(`^([^ ]+)(?: \((.*)\))?$`)
+
+// MarshalText prints i as String does, e.g. "17.0.1 (21A340, 21A341)". The
+// Darwin version and the release date are not part of the text form.
+func (i IOSVersion) MarshalText() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// UnmarshalText parses the output of MarshalText; the build list is
+// optional.
+func (i *IOSVersion) UnmarshalText(text []byte) error {
+	m := iosVersionTextRegex.FindStringSubmatch(string(text))
+	if m == nil {
+		return fmt.Errorf("%q is not a release like 17.0.1 (21A340, 21A341)", string(text))
+	}
+	var out IOSVersion
+	if err := out.Version.UnmarshalText([]byte(m[1])); err != nil {
+		return err
+	}
+	if m[2] != "" {
+		for _, build := range strings.Split(m[2], ", ") {
+			var bn BuildNumber
+			if err := bn.UnmarshalText([]byte(build)); err != nil {
+				return err
+			}
+			out.Builds = append(out.Builds, bn)
+		}
+	}
+	*i = out
+	return nil
+}
+
+type iosVersionJSON struct {
+	Version OSVersion     `json:"version"`
+	Builds  []BuildNumber `json:"builds"`
+	Darwin  *OSVersion    `json:"darwin,omitempty"`
+	// date only, e.g. "2023-09-18"
+	Released string `json:"released,omitempty"`
+}
+
+// ReleaseDateLayout is the layout of release dates in text forms.
+const ReleaseDateLayout = "2006-01-02"
+
+// MarshalJSON encodes i as an object, e.g.
+// {"version":"17.0.1","builds":["21A340"],"darwin":"23.0.0","released":"2023-09-21"},
+// darwin and released being left out when unknown.
+func (i IOSVersion) MarshalJSON() ([]byte, error) {
+	builds := i.Builds
+	if builds == nil {
+		builds = []BuildNumber{}
+	}
+	obj := iosVersionJSON{Version: i.Version, Builds: builds, Darwin: i.Darwin}
+	if i.Released != nil {
+		obj.Released = i.Released.Format(ReleaseDateLayout)
+	}
+	return json.Marshal(obj)
+}
+
+// UnmarshalJSON accepts both the object form of MarshalJSON and the text
+// form of MarshalText.
+func (i *IOSVersion) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return i.UnmarshalText([]byte(text))
+	}
+	var obj iosVersionJSON
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	out := IOSVersion{Version: obj.Version, Builds: obj.Builds, Darwin: obj.Darwin}
+	if obj.Released != "" {
+		released, err := time.Parse(ReleaseDateLayout, obj.Released)
+		if err != nil {
+			return fmt.Errorf("bad release date %q: %w", obj.Released, err)
+		}
+		out.Released = &released
+	}
+	*i = out
+	if len(i.Builds) == 0 {
+		i.Builds = nil
+	}
+	return nil
+}
+
+// Value stores i in its text form.
+func (i IOSVersion) Value() (driver.Value, error) {
+	return i.String(), nil
+}
+
+func (i *IOSVersion) Scan(src interface{}) error {
+	switch val := src.(type) {
+	case []byte:
+		return i.UnmarshalText(val)
+	case string:
+		return i.UnmarshalText([]byte(val))
+	}
+	return fmt.Errorf("cannot scan %T into a release", src)
+}
+
+func (IOSVersion) GormDataType() string {
+	return "string"
+}
@@ -0,0 +1,96 @@
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseOSVersion is the strict counterpart of OSVersionFromString: it only
+// accepts one to three dot-separated decimal components without leading
+// zeros, sign or surrounding text, e.g. "17", "17.4" or "17.4.1", and
+// tells what is wrong with anything else.
+func ParseOSVersion(s string) (OSVersion, error) {
+	if s == "" {
+		return OSVersion{}, fmt.Errorf("empty version")
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return OSVersion{}, fmt.Errorf("version %q has %d components, at most 3 are allowed", s, len(parts))
+	}
+	var components [3]int
+	offset := 0
+	for i, part := range parts {
+		if part == "" {
+			return OSVersion{}, fmt.Errorf("version %q: component %d is empty", s, i+1)
+		}
+		for j, r := range part {
+			if r < '0' || r > '9' {
+				return OSVersion{}, fmt.Errorf("version %q: unexpected %q at offset %d", s, r, offset+j)
+			}
+		}
+		if len(part) > 1 && part[0] == '0' {
+			return OSVersion{}, fmt.Errorf("version %q: component %d has a leading zero", s, i+1)
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return OSVersion{}, fmt.Errorf("version %q: component %d is out of range", s, i+1)
+		}
+		components[i] = n
+		offset += len(part) + 1
+	}
+	return OSVersion{X: components[0], Y: components[1], Z: components[2]}, nil
+}
+
+// LenientVersion is a version read from free text, e.g. a Wikipedia cell
+// like "17.0.1 (a)[12]", along with the text that followed it.
+type LenientVersion struct {
+	Version OSVersion
+	// Suffix is the trimmed text after the version, e.g. "(a)[12]"
+	Suffix string
+	// Annotations are the contents of the parenthesized and bracketed
+	// notes of Suffix, e.g. "a" and "12"
+	Annotations []string
+}
+
+var (
+	lenientVersionRegex = regexp.MustCompile(`^([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?`)
+	annotationRegex     = regexp.MustCompile(`[(\[]\s*([^()\[\]]*?)\s*[)\]]`)
+)
+
+// ExtractOSVersion reads the version text starts with, after optional
+// whitespace, and returns it along with whatever follows as the suffix.
+// Leading zeros are tolerated and any text other than a dot may follow the
+// version: "17.0.1a" yields 17.0.1 with suffix "a" and "1.3,4" yields 1.3.0
+// with suffix ",4", while "1.2.3.4" and "17.0." are rejected.
+func ExtractOSVersion(text string) (LenientVersion, error) {
+	trimmed := strings.TrimSpace(text)
+	m := lenientVersionRegex.FindStringSubmatch(trimmed)
+	if m == nil {
+		return LenientVersion{}, fmt.Errorf("no version at the start of %q", text)
+	}
+	rest := trimmed[len(m[0]):]
+	if strings.HasPrefix(rest, ".") {
+		if len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9' {
+			return LenientVersion{}, fmt.Errorf("%q: version has more than 3 components", text)
+		}
+		return LenientVersion{}, fmt.Errorf("%q: version ends with a dot", text)
+	}
+	var out LenientVersion
+	for i, component := range []*int{&out.Version.X, &out.Version.Y, &out.Version.Z} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return LenientVersion{}, fmt.Errorf("%q: component %d is out of range", text, i+1)
+		}
+		*component = n
+	}
+	out.Suffix = strings.TrimSpace(rest)
+	for _, a := range annotationRegex.FindAllStringSubmatch(out.Suffix, -1) {
+		out.Annotations = append(out.Annotations, a[1])
+	}
+	return out, nil
+}
@@ -0,0 +1,306 @@
+package version
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// OSVersionSet is a union of version ranges, e.g. every release a rule
+// applies to. Sets are kept normalized: their ranges are non-empty,
+// disjoint and sorted, so that equal sets print the same.
+type OSVersionSet struct {
+	ranges []OSVersionRange
+}
+
+// AllOSVersions is the set of every version.
+var AllOSVersions = OSVersionSet{ranges: []OSVersionRange{{Left: OSVersionRangeLimit{Unbounded: true}, Right: OSVersionRangeLimit{Unbounded: true}}}}
+
+// NewOSVersionSet returns the union of ranges.
+func NewOSVersionSet(ranges ...OSVersionRange) OSVersionSet {
+	return normalize(ranges)
+}
+
+// Ranges returns the disjoint ranges s is made of, in ascending order.
+func (s OSVersionSet) Ranges() []OSVersionRange {
+	return append([]OSVersionRange{}, s.ranges...)
+}
+
+func (s OSVersionSet) IsEmpty() bool {
+	return len(s.ranges) == 0
+}
+
+func (s OSVersionSet) Contains(v OSVersion) bool {
+	for _, r := range s.ranges {
+		if v.InRange(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s OSVersionSet) Eq(rhs OSVersionSet) bool {
+	return s.String() == rhs.String()
+}
+
+// String prints s as comma-separated intervals, "none" when s is empty.
+// The output parses back to the same set.
+func (s OSVersionSet) String() string {
+	if s.IsEmpty() {
+		return "none"
+	}
+	var out []string
+	for _, r := range s.ranges {
+		out = append(out, r.String())
+	}
+	return strings.Join(out, ",")
+}
+
+func (s OSVersionSet) Union(rhs OSVersionSet) OSVersionSet {
+	return normalize(append(s.Ranges(), rhs.ranges...))
+}
+
+func (s OSVersionSet) Intersect(rhs OSVersionSet) OSVersionSet {
+	var out []OSVersionRange
+	for _, a := range s.ranges {
+		for _, b := range rhs.ranges {
+			out = append(out, OSVersionRange{Left: maxLower(a.Left, b.Left), Right: minUpper(a.Right, b.Right)})
+		}
+	}
+	return normalize(out)
+}
+
+// Complement returns every version not in s.
+func (s OSVersionSet) Complement() OSVersionSet {
+	var out []OSVersionRange
+	from := OSVersionRangeLimit{Unbounded: true}
+	for _, r := range s.ranges {
+		if !r.Left.Unbounded {
+			out = append(out, OSVersionRange{Left: from, Right: OSVersionRangeLimit{V: r.Left.V, Inclusive: !r.Left.Inclusive}})
+		}
+		if r.Right.Unbounded {
+			return normalize(out)
+		}
+		from = OSVersionRangeLimit{V: r.Right.V, Inclusive: !r.Right.Inclusive}
+	}
+	out = append(out, OSVersionRange{Left: from, Right: OSVersionRangeLimit{Unbounded: true}})
+	return normalize(out)
+}
+
+// compareLower orders left limits: unbounded first, then by version, an
+// inclusive limit starting before an exclusive one on the same version.
+func compareLower(a OSVersionRangeLimit, b OSVersionRangeLimit) int {
+	switch {
+	case a.Unbounded || b.Unbounded:
+		return boolRank(!a.Unbounded) - boolRank(!b.Unbounded)
+	case !a.V.Eq(b.V):
+		if a.V.Lt(b.V) {
+			return -1
+		}
+		return 1
+	}
+	return boolRank(!a.Inclusive) - boolRank(!b.Inclusive)
+}
+
+// compareUpper orders right limits: by version, an exclusive limit ending
+// before an inclusive one on the same version, unbounded last.
+func compareUpper(a OSVersionRangeLimit, b OSVersionRangeLimit) int {
+	switch {
+	case a.Unbounded || b.Unbounded:
+		return boolRank(a.Unbounded) - boolRank(b.Unbounded)
+	case !a.V.Eq(b.V):
+		if a.V.Lt(b.V) {
+			return -1
+		}
+		return 1
+	}
+	return boolRank(a.Inclusive) - boolRank(b.Inclusive)
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func maxLower(a OSVersionRangeLimit, b OSVersionRangeLimit) OSVersionRangeLimit {
+	if compareLower(a, b) < 0 {
+		return b
+	}
+	return a
+}
+
+func minUpper(a OSVersionRangeLimit, b OSVersionRangeLimit) OSVersionRangeLimit {
+	if compareUpper(a, b) > 0 {
+		return b
+	}
+	return a
+}
+
+func isEmptyRange(r OSVersionRange) bool {
+	if r.Left.Unbounded || r.Right.Unbounded {
+		return false
+	}
+	return r.Left.V.Gt(r.Right.V) || (r.Left.V.Eq(r.Right.V) && !(r.Left.Inclusive && r.Right.Inclusive))
+}
+
+// joinable tells whether b, which does not start before a, overlaps or
+// touches a so that their union is a single range.
+func joinable(a OSVersionRange, b OSVersionRange) bool {
+	switch {
+	case a.Right.Unbounded || b.Left.Unbounded:
+		return true
+	case !a.Right.V.Eq(b.Left.V):
+		return a.Right.V.Gt(b.Left.V)
+	}
+	return a.Right.Inclusive || b.Left.Inclusive
+}
+
+func normalize(ranges []OSVersionRange) OSVersionSet {
+	var sorted []OSVersionRange
+	for _, r := range ranges {
+		if !isEmptyRange(r) {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareLower(sorted[i].Left, sorted[j].Left) < 0
+	})
+	var out []OSVersionRange
+	for _, r := range sorted {
+		if last := len(out) - 1; last >= 0 && joinable(out[last], r) {
+			if compareUpper(r.Right, out[last].Right) > 0 {
+				out[last].Right = r.Right
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return OSVersionSet{ranges: out}
+}
+
+var (
+	intervalRegex   = regexp.MustCompile(`^([\[(])\s*([0-9.]*)\s*,\s*([0-9.]*)\s*([\])])`)
+	constraintRegex = regexp.MustCompile(`^(>=|<=|!=|==|>|<|=)?\s*([0-9.]+)`)
+)
+
+func parseRangeVersion(s string, expr string) (OSVersion, error) {
+	v, err := ParseOSVersion(s)
+	if err != nil {
+		return OSVersion{}, fmt.Errorf("%q: %w", expr, err)
+	}
+	return v, nil
+}
+
+func parseInterval(m []string, expr string) (OSVersionRange, error) {
+	var rng OSVersionRange
+	var err error
+	if m[2] == "" {
+		rng.Left.Unbounded = true
+	} else if rng.Left.V, err = parseRangeVersion(m[2], expr); err != nil {
+		return rng, err
+	}
+	if m[3] == "" {
+		rng.Right.Unbounded = true
+	} else if rng.Right.V, err = parseRangeVersion(m[3], expr); err != nil {
+		return rng, err
+	}
+	rng.Left.Inclusive = !rng.Left.Unbounded && m[1] == "["
+	rng.Right.Inclusive = !rng.Right.Unbounded && m[4] == "]"
+	return rng, nil
+}
+
+// ParseOSVersionRange parses a single interval as printed by
+// OSVersionRange.String, e.g. "[1.0.0,2.0.0)" or "[15.0,)".
+func ParseOSVersionRange(s string) (OSVersionRange, error) {
+	trimmed := strings.TrimSpace(s)
+	m := intervalRegex.FindStringSubmatch(trimmed)
+	if m == nil || len(m[0]) != len(trimmed) {
+		return OSVersionRange{}, fmt.Errorf("%q is not an interval like [1.0.0,2.0.0)", s)
+	}
+	return parseInterval(m, s)
+}
+
+func constraintSet(op string, v OSVersion) OSVersionSet {
+	switch op {
+	case ">=":
+		return NewOSVersionSet(OSVersionRange{Left: OSVersionRangeLimit{V: v, Inclusive: true}, Right: OSVersionRangeLimit{Unbounded: true}})
+	case ">":
+		return NewOSVersionSet(OSVersionRange{Left: OSVersionRangeLimit{V: v}, Right: OSVersionRangeLimit{Unbounded: true}})
+	case "<=":
+		return NewOSVersionSet(OSVersionRange{Left: OSVersionRangeLimit{Unbounded: true}, Right: OSVersionRangeLimit{V: v, Inclusive: true}})
+	case "<":
+		return NewOSVersionSet(OSVersionRange{Left: OSVersionRangeLimit{Unbounded: true}, Right: OSVersionRangeLimit{V: v}})
+	}
+	exact := NewOSVersionSet(OSVersionRange{Left: OSVersionRangeLimit{V: v, Inclusive: true}, Right: OSVersionRangeLimit{V: v, Inclusive: true}})
+	if op == "!=" {
+		return exact.Complement()
+	}
+	return exact
+}
+
+// parseTerm parses either a list of intervals, which are united, or a list
+// of constraints, which must all hold.
+func parseTerm(term string, expr string) (OSVersionSet, error) {
+	rest := strings.TrimSpace(term)
+	if rest == "" {
+		return OSVersionSet{}, fmt.Errorf("%q: empty range expression", expr)
+	}
+	if rest == "none" {
+		return OSVersionSet{}, nil
+	}
+	if rest == "*" {
+		return AllOSVersions, nil
+	}
+	intervals := strings.HasPrefix(rest, "[") || strings.HasPrefix(rest, "(")
+	set := AllOSVersions
+	if intervals {
+		set = OSVersionSet{}
+	}
+	for rest != "" {
+		if intervals {
+			m := intervalRegex.FindStringSubmatch(rest)
+			if m == nil {
+				return OSVersionSet{}, fmt.Errorf("%q: expected an interval at %q", expr, rest)
+			}
+			rng, err := parseInterval(m, expr)
+			if err != nil {
+				return OSVersionSet{}, err
+			}
+			set = set.Union(NewOSVersionSet(rng))
+			rest = rest[len(m[0]):]
+		} else {
+			m := constraintRegex.FindStringSubmatch(rest)
+			if m == nil {
+				return OSVersionSet{}, fmt.Errorf("%q: expected a constraint like >=15.0 at %q", expr, rest)
+			}
+			v, err := parseRangeVersion(m[2], expr)
+			if err != nil {
+				return OSVersionSet{}, err
+			}
+			set = set.Intersect(constraintSet(m[1], v))
+			rest = rest[len(m[0]):]
+		}
+		rest = strings.TrimLeft(rest, " \t,")
+	}
+	return set, nil
+}
+
+// ParseOSVersionSet parses a version set expression: "||"-separated terms,
+// each being either intervals ("[15.0.0,16.0.0),[17.0.0,)", united) or
+// constraints (">=15.0 <17", "!=16.1", "16.0", all of which must hold).
+// "none" and "*" stand for no and every version. OSVersionSet.String
+// output is a valid expression.
+func ParseOSVersionSet(expr string) (OSVersionSet, error) {
+	var set OSVersionSet
+	for _, term := range strings.Split(expr, "||") {
+		termSet, err := parseTerm(term, expr)
+		if err != nil {
+			return OSVersionSet{}, err
+		}
+		set = set.Union(termSet)
+	}
+	return set, nil
+}
@@ -2,6 +2,7 @@ package version
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -14,6 +15,8 @@ type OSVersion struct {
 type OSVersionRangeLimit struct {
 	V         OSVersion
 	Inclusive bool
+	// Unbounded limits have no version: V and Inclusive are ignored
+	Unbounded bool
 }
 type OSVersionRange struct {
 	Left  OSVersionRangeLimit
@@ -39,20 +42,30 @@ func (o OSVersion) Gte(rhs OSVersion) bool {
 	return !o.Lt(rhs)
 }
 func (o OSVersion) InRange(rng OSVersionRange) bool {
-	return (o.Gt(rng.Left.V) || (rng.Left.Inclusive && o.Eq(rng.Left.V))) &&
-		(o.Lt(rng.Right.V) || (rng.Right.Inclusive && o.Eq(rng.Right.V)))
+	return (rng.Left.Unbounded || o.Gt(rng.Left.V) || (rng.Left.Inclusive && o.Eq(rng.Left.V))) &&
+		(rng.Right.Unbounded || o.Lt(rng.Right.V) || (rng.Right.Inclusive && o.Eq(rng.Right.V)))
 }
 func (ovrl OSVersionRange) String() string {
 	var leftbkt, rightbkt string = "(", ")"
-	if ovrl.Left.Inclusive {
-		leftbkt = "["
+	var left, right string
+	if !ovrl.Left.Unbounded {
+		left = ovrl.Left.V.String()
+		if ovrl.Left.Inclusive {
+			leftbkt = "["
+		}
 	}
-	if ovrl.Right.Inclusive {
-		rightbkt = "]"
+	if !ovrl.Right.Unbounded {
+		right = ovrl.Right.V.String()
+		if ovrl.Right.Inclusive {
+			rightbkt = "]"
+		}
 	}
-	return fmt.Sprintf("%s%s,%s%s", leftbkt, ovrl.Left.V.String(), ovrl.Right.V.String(), rightbkt)
+	return fmt.Sprintf("%s%s,%s%s", leftbkt, left, right, rightbkt)
 }
 
+// OSVersionFromString reads up to three leading dot-separated components
+// of verstring and ignores any further one. Use ParseOSVersion to validate
+// input, or ExtractOSVersion to read a version out of free text.
 func OSVersionFromString(verstring string) (OSVersion, error) {
 	var outver OSVersion = OSVersion{X: 0, Y: 0, Z: 0}
 	var parts []string = strings.Split(verstring, ".")
@@ -75,3 +88,22 @@ func OSVersionFromString(verstring string) (OSVersion, error) {
 	}
 	return outver, nil
 }
+
+// SortVersionStrings sorts "x.y.z" strings in version order, so that
+// "17.10.0" comes after "17.2.0". Strings that are not versions go last,
+// in string order.
+func SortVersionStrings(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		vi, erri := OSVersionFromString(versions[i])
+		vj, errj := OSVersionFromString(versions[j])
+		switch {
+		case erri != nil && errj != nil:
+			return versions[i] < versions[j]
+		case erri != nil || errj != nil:
+			return errj != nil
+		case vi.Eq(vj):
+			return versions[i] < versions[j]
+		}
+		return vi.Lt(vj)
+	})
+}
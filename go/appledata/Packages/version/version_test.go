@@ -1,7 +1,15 @@
 package version
 
 import (
+	"encoding/json"
+	"math/rand"
+	"strings"
 	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 func TestOsVersionFromString(t *testing.T) {
@@ -120,6 +128,14 @@ func TestCompareFunctions(t *testing.T) {
 		t.Fatalf("%s should be greater than or equal to %s", ver2.String(), ver1_1.String())
 	}
 }
+func TestSortVersionStrings(t *testing.T) {
+	versions := []string{"17.10.0", "x", "17.2.0", "9.3.5", "17.2.1"}
+	SortVersionStrings(versions)
+	if strings.Join(versions, " ") != "9.3.5 17.2.0 17.2.1 17.10.0 x" {
+		t.Fatalf("Unexpected order: %v", versions)
+	}
+}
+
 func TestRanges(t *testing.T) {
 	ver0, _ := OSVersionFromString("1.0.0")
 	ver2, _ := OSVersionFromString("2.0.0")
@@ -162,3 +178,511 @@ func TestRanges(t *testing.T) {
 		t.Fatalf("%s should NOT be in range %s", testVer.String(), rng.String())
 	}
 }
+
+func TestHardwareIdentifier(t *testing.T) {
+	for _, s := range []string{"iPhone14,2", "iPad13,18", "Watch6,1", "AppleTV11,1", "MacBookPro18,3", "AudioAccessory5,1", "RealityDevice14,1"} {
+		hw, err := HardwareIdentifierFromString(s)
+		if err != nil {
+			t.Fatalf("%s: %s", s, err.Error())
+		}
+		if hw.String() != s {
+			t.Fatalf("%s should print back as itself, got %s", s, hw.String())
+		}
+	}
+	hw, _ := HardwareIdentifierFromString("iMac21,1")
+	if hw.Family() != FamilyMac || hw.Prefix != "iMac" || hw.Major != 21 || hw.Minor != 1 {
+		t.Fatalf("Unexpected parse of iMac21,1: %+v", hw)
+	}
+	for _, s := range []string{"iPhone14", "iPhone14,2,1", "Pixel7,1", "iPhone0,1", " iPhone14,2", "iPhone,2"} {
+		if _, err := HardwareIdentifierFromString(s); err == nil {
+			t.Fatalf("%q should not be a valid hardware identifier", s)
+		}
+	}
+	if HardwareFamily("iPod9,1") != FamilyIPod || HardwareFamily("unknown") != "" {
+		t.Fatalf("Unexpected families")
+	}
+}
+
+func TestHardwareIdentifierOrder(t *testing.T) {
+	var ids []HardwareIdentifier
+	for _, s := range []string{"iPhone9,1", "iPhone10,1", "iPhone10,2", "iPad1,1", "Watch1,1", "MacBookAir10,1", "iMac21,1"} {
+		hw, _ := HardwareIdentifierFromString(s)
+		ids = append(ids, hw)
+	}
+	for i := 0; i+1 < len(ids); i++ {
+		if !ids[i].Lt(ids[i+1]) || ids[i+1].Lt(ids[i]) {
+			t.Fatalf("%s should sort before %s", ids[i].String(), ids[i+1].String())
+		}
+	}
+	if !ids[0].Eq(ids[0]) {
+		t.Fatalf("%s should equal itself", ids[0].String())
+	}
+}
+
+func TestFindHardwareIdentifiers(t *testing.T) {
+	found := FindHardwareIdentifiers("<td>iPhone14,2<br/>iPhone14,3 Pixel7,1</td> MyApp (iPad13,18; iOS 17.0)")
+	if len(found) != 3 || found[0].String() != "iPhone14,2" || found[2].Family() != FamilyIPad {
+		t.Fatalf("Unexpected identifiers: %v", found)
+	}
+}
+
+func TestBuildNumberOrder(t *testing.T) {
+	var builds []BuildNumber
+	for _, s := range []string{"20A362", "20B82", "21A5248v", "21A5291j", "21A329", "21A340", "21A341", "21A341a", "21B74"} {
+		bn, err := BuildNumberFromString(s)
+		if err != nil {
+			t.Fatalf("%s: %s", s, err.Error())
+		}
+		builds = append(builds, bn)
+	}
+	for i := 0; i+1 < len(builds); i++ {
+		if !builds[i].Lt(builds[i+1]) || !builds[i+1].Gt(builds[i]) {
+			t.Fatalf("%s should sort before %s", builds[i].String(), builds[i+1].String())
+		}
+	}
+	if !builds[2].IsBeta() || builds[4].IsBeta() {
+		t.Fatalf("Unexpected beta detection")
+	}
+	if !builds[0].Eq(builds[0]) || !builds[0].Lte(builds[0]) || !builds[0].Gte(builds[0]) {
+		t.Fatalf("%s should equal itself", builds[0].String())
+	}
+}
+
+func TestBuildNumberInference(t *testing.T) {
+	for s, expected := range map[string]int{"1A543a": 1, "4A102": 1, "5A347": 2, "7A341": 3, "15A372": 11, "21A329": 17, "22A3354": 18, "23A341": 26, "23B85": 26, "24A100": 27} {
+		bn, _ := BuildNumberFromString(s)
+		major, err := bn.IOSMajor()
+		if err != nil || major != expected {
+			t.Fatalf("%s: expected iOS %d, got %d %v", s, expected, major, err)
+		}
+	}
+	for s, expected := range map[string]string{"20A362": "Sydney", "21A329": "Dawn", "22A3354": "Crystal", "23A341": "Luck"} {
+		bn, _ := BuildNumberFromString(s)
+		if train, err := bn.Train(); err != nil || train != expected {
+			t.Fatalf("Unexpected train of %s: %s %v", bn.String(), train, err)
+		}
+	}
+	bn, _ := BuildNumberFromString("23A341")
+	ios, _ := DarwinToIOS(OSVersion{X: 25})
+	if major, _ := bn.IOSMajor(); major != ios.X {
+		t.Fatalf("Build and Darwin majors of iOS 26 disagree: %d and %d", major, ios.X)
+	}
+	bn, _ = BuildNumberFromString("6A100")
+	if _, err := bn.IOSMajor(); err == nil {
+		t.Fatalf("%s should not map to an iOS release", bn.String())
+	}
+	bn, _ = BuildNumberFromString("99A1")
+	if _, err := bn.Train(); err == nil {
+		t.Fatalf("%s should have no known train", bn.String())
+	}
+}
+
+func TestParseOSVersionRange(t *testing.T) {
+	for _, s := range []string{"[1.0.0,2.0.0)", "(1.0.0,2.0.0]", "[15.0.0,)", "(,17.0.0)", "(,)"} {
+		rng, err := ParseOSVersionRange(s)
+		if err != nil {
+			t.Fatalf("%s: %s", s, err.Error())
+		}
+		if rng.String() != s {
+			t.Fatalf("%s should print back as itself, got %s", s, rng.String())
+		}
+	}
+	rng, _ := ParseOSVersionRange("[ 15.0 , 16 )")
+	if rng.String() != "[15.0.0,16.0.0)" {
+		t.Fatalf("Unexpected range %s", rng.String())
+	}
+	for _, s := range []string{"", "[1.0.0,2.0.0", "1.0.0,2.0.0)", "[1.0.0,2.0.0) x", "[a,b)", "[1.2.3.4,)"} {
+		if _, err := ParseOSVersionRange(s); err == nil {
+			t.Fatalf("%q should not parse as a range", s)
+		}
+	}
+}
+
+func TestParseOSVersionSet(t *testing.T) {
+	for expr, expected := range map[string]string{
+		">=15.0 <17":                  "[15.0.0,17.0.0)",
+		">= 15.0, < 17":               "[15.0.0,17.0.0)",
+		"16.1":                        "[16.1.0,16.1.0]",
+		">=16 !=16.1":                 "[16.0.0,16.1.0),(16.1.0,)",
+		"<15 || >=17":                 "(,15.0.0),[17.0.0,)",
+		"[15.0.0,16.0.0),[16.0.0,17)": "[15.0.0,17.0.0)",
+		"[15.0.0,16.0.0) (16.0.0,17]": "[15.0.0,16.0.0),(16.0.0,17.0.0]",
+		">=17 <15":                    "none",
+		"none":                        "none",
+		"*":                           "(,)",
+		">=15 || [10.0.0,16.0.0]":     "[10.0.0,)",
+	} {
+		set, err := ParseOSVersionSet(expr)
+		if err != nil {
+			t.Fatalf("%s: %s", expr, err.Error())
+		}
+		if set.String() != expected {
+			t.Fatalf("%s: expected %s, got %s", expr, expected, set.String())
+		}
+		reparsed, err := ParseOSVersionSet(set.String())
+		if err != nil || !reparsed.Eq(set) {
+			t.Fatalf("%s: %s does not parse back to itself: %s %v", expr, set.String(), reparsed.String(), err)
+		}
+	}
+	for _, expr := range []string{"", ">=", "~15", ">=15 ||", "[15.0.0,16.0.0) >=15"} {
+		if _, err := ParseOSVersionSet(expr); err == nil {
+			t.Fatalf("%q should not parse", expr)
+		}
+	}
+}
+
+func TestOSVersionSetAlgebra(t *testing.T) {
+	set := func(expr string) OSVersionSet {
+		s, err := ParseOSVersionSet(expr)
+		if err != nil {
+			t.Fatalf("%s: %s", expr, err.Error())
+		}
+		return s
+	}
+	a, b := set(">=15 <17"), set(">=16 <18")
+	if got := a.Union(b).String(); got != "[15.0.0,18.0.0)" {
+		t.Fatalf("Unexpected union %s", got)
+	}
+	if got := a.Intersect(b).String(); got != "[16.0.0,17.0.0)" {
+		t.Fatalf("Unexpected intersection %s", got)
+	}
+	if got := a.Complement().String(); got != "(,15.0.0),[17.0.0,)" {
+		t.Fatalf("Unexpected complement %s", got)
+	}
+	if !a.Complement().Complement().Eq(a) || !AllOSVersions.Complement().IsEmpty() || !(OSVersionSet{}).Complement().Eq(AllOSVersions) {
+		t.Fatalf("Complement should be an involution")
+	}
+	if !a.Intersect(a.Complement()).IsEmpty() || !a.Union(a.Complement()).Eq(AllOSVersions) {
+		t.Fatalf("A set and its complement should partition every version")
+	}
+	v16, _ := OSVersionFromString("16.4.1")
+	v17, _ := OSVersionFromString("17.0")
+	if !a.Contains(v16) || a.Contains(v17) || !set("*").Contains(v17) {
+		t.Fatalf("Unexpected membership")
+	}
+}
+
+func TestVersionTextRoundTrip(t *testing.T) {
+	for _, s := range []string{"17.4.1", "0.0.0", "999.999.999"} {
+		var v OSVersion
+		if err := v.UnmarshalText([]byte(s)); err != nil {
+			t.Fatalf("%s: %s", s, err.Error())
+		}
+		if text, _ := v.MarshalText(); string(text) != s {
+			t.Fatalf("%s printed back as %s", s, text)
+		}
+	}
+	for _, s := range []string{"", "17.", "1.2.3.4", "v17", "17.4 "} {
+		var v OSVersion
+		if err := v.UnmarshalText([]byte(s)); err == nil {
+			t.Fatalf("%q should not unmarshal as a version", s)
+		}
+	}
+	for _, s := range []string{"21A329", "21A5248v", "7A341", "1A543a", ""} {
+		var b BuildNumber
+		if err := b.UnmarshalText([]byte(s)); err != nil {
+			t.Fatalf("%s: %s", s, err.Error())
+		}
+		if text, _ := b.MarshalText(); string(text) != s {
+			t.Fatalf("%s printed back as %s", s, text)
+		}
+	}
+	for _, s := range []string{"21a329", "x21A329", "21A329 ", "021A329"} {
+		var b BuildNumber
+		if err := b.UnmarshalText([]byte(s)); err == nil {
+			t.Fatalf("%q should not unmarshal as a build number", s)
+		}
+	}
+	for _, s := range []string{"17.0.1 (21A340, 21A341)", "16.0.0 ()"} {
+		var i IOSVersion
+		if err := i.UnmarshalText([]byte(s)); err != nil {
+			t.Fatalf("%s: %s", s, err.Error())
+		}
+		if text, _ := i.MarshalText(); string(text) != s {
+			t.Fatalf("%s printed back as %s", s, text)
+		}
+	}
+}
+
+func TestVersionJSONRoundTrip(t *testing.T) {
+	type document struct {
+		Min     OSVersion              `json:"min"`
+		Max     *OSVersion             `json:"max"`
+		Build   BuildNumber            `json:"build"`
+		Release IOSVersion             `json:"release"`
+		ByVer   map[OSVersion][]string `json:"by_version"`
+	}
+	v, _ := OSVersionFromString("17.0.1")
+	b, _ := BuildNumberFromString("21A341")
+	doc := document{Min: v, Max: &v, Build: b, Release: IOSVersion{Version: v, Builds: []BuildNumber{b}}, ByVer: map[OSVersion][]string{v: {"iPhone15,4"}}}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := `{"min":"17.0.1","max":"17.0.1","build":"21A341","release":{"version":"17.0.1","builds":["21A341"]},"by_version":{"17.0.1":["iPhone15,4"]}}`
+	if string(data) != expected {
+		t.Fatalf("Unexpected JSON %s", data)
+	}
+	var back document
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !back.Min.Eq(v) || !back.Max.Eq(v) || !back.Build.Eq(b) || back.Release.String() != doc.Release.String() || len(back.ByVer[v]) != 1 {
+		t.Fatalf("Unexpected round trip: %+v", back)
+	}
+	var release IOSVersion
+	if err := json.Unmarshal([]byte(`"17.0.1 (21A341)"`), &release); err != nil || release.String() != doc.Release.String() {
+		t.Fatalf("The text form should unmarshal as well: %+v %v", release, err)
+	}
+	if err := json.Unmarshal([]byte(`{"min":"17.x"}`), &back); err == nil {
+		t.Fatalf("A bad version should fail to unmarshal")
+	}
+	darwin, _ := OSVersionFromString("23.0.0")
+	data, _ = json.Marshal(IOSVersion{Version: v, Darwin: &darwin})
+	if string(data) != `{"version":"17.0.1","builds":[],"darwin":"23.0.0"}` {
+		t.Fatalf("Unexpected JSON %s", data)
+	}
+	if err := json.Unmarshal(data, &release); err != nil || release.Darwin == nil || !release.Darwin.Eq(darwin) {
+		t.Fatalf("Darwin version lost in round trip: %+v %v", release, err)
+	}
+	released := time.Date(2023, time.September, 21, 0, 0, 0, 0, time.UTC)
+	data, _ = json.Marshal(IOSVersion{Version: v, Released: &released})
+	if string(data) != `{"version":"17.0.1","builds":[],"released":"2023-09-21"}` {
+		t.Fatalf("Unexpected JSON %s", data)
+	}
+	if err := json.Unmarshal(data, &release); err != nil || release.Released == nil || !release.Released.Equal(released) {
+		t.Fatalf("Release date lost in round trip: %+v %v", release, err)
+	}
+	if err := json.Unmarshal([]byte(`{"version":"17.0.1","released":"21/09/2023"}`), &release); err == nil {
+		t.Fatalf("A bad release date should fail to unmarshal")
+	}
+}
+
+func TestDarwinConversions(t *testing.T) {
+	for ios, darwin := range map[string]string{"9.3.5": "15.3.0", "17.4.1": "23.4.0", "18.0": "24.0.0", "26.1": "25.1.0"} {
+		v, _ := OSVersionFromString(ios)
+		d, err := IOSToDarwin(v)
+		if err != nil || d.String() != darwin {
+			t.Fatalf("iOS %s: expected Darwin %s, got %s (%v)", ios, darwin, d.String(), err)
+		}
+		back, err := DarwinToIOS(d)
+		if err != nil || back.X != v.X || back.Y != v.Y || back.Z != 0 {
+			t.Fatalf("Darwin %s: expected iOS %d.%d, got %s (%v)", darwin, v.X, v.Y, back.String(), err)
+		}
+	}
+	for _, ios := range []string{"8.4", "19.0"} {
+		v, _ := OSVersionFromString(ios)
+		if _, err := IOSToDarwin(v); err == nil {
+			t.Fatalf("iOS %s should have no Darwin major version", ios)
+		}
+	}
+	for macos, darwin := range map[string]string{"10.5": "9.0.0", "10.15.7": "19.0.0", "11.2": "20.0.0", "14.4": "23.0.0", "26.0": "25.0.0"} {
+		v, _ := OSVersionFromString(macos)
+		d, err := MacOSToDarwin(v)
+		if err != nil || d.String() != darwin {
+			t.Fatalf("macOS %s: expected Darwin %s, got %s (%v)", macos, darwin, d.String(), err)
+		}
+		back, err := DarwinToMacOS(d)
+		if err != nil || back.X != v.X || (v.X == 10 && back.Y != v.Y) {
+			t.Fatalf("Darwin %s: expected macOS %s, got %s (%v)", darwin, macos, back.String(), err)
+		}
+	}
+	if _, err := DarwinToMacOS(OSVersion{X: 8}); err == nil {
+		t.Fatalf("Darwin 8 should have no macOS version")
+	}
+}
+
+func TestFindDarwinVersion(t *testing.T) {
+	for text, expected := range map[string]string{
+		"MyApp/42 CFNetwork/1494.0.7 Darwin/23.4.0":                                 "23.4.0",
+		"Darwin Kernel Version 21.6.0: Mon Aug 22 20:20:07 PDT 2022; root:xnu-8020": "21.6.0",
+		"com.apple.trustd/3.0 Darwin 22":                                            "22.0.0",
+	} {
+		d := FindDarwinVersion(text)
+		if d == nil || d.String() != expected {
+			t.Fatalf("%s: expected %s, got %v", text, expected, d)
+		}
+	}
+	for _, text := range []string{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X)", "Darwin/023.1"} {
+		if d := FindDarwinVersion(text); d != nil {
+			t.Fatalf("%s: expected no Darwin version, got %s", text, d.String())
+		}
+	}
+}
+
+func TestVersionSQLValue(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		a := OSVersion{X: r.Intn(30), Y: r.Intn(20), Z: r.Intn(10)}
+		b := OSVersion{X: r.Intn(30), Y: r.Intn(20), Z: r.Intn(10)}
+		va, _ := a.Value()
+		vb, _ := b.Value()
+		if (va.(int64) < vb.(int64)) != a.Lt(b) {
+			t.Fatalf("Stored values of %s and %s do not sort like the versions", a.String(), b.String())
+		}
+		var back OSVersion
+		if err := back.Scan(va); err != nil || !back.Eq(a) {
+			t.Fatalf("%s did not survive a Value/Scan round trip: %s %v", a.String(), back.String(), err)
+		}
+	}
+	if _, err := (OSVersion{X: 1, Y: 1000}).Value(); err == nil {
+		t.Fatalf("A minor version of 1000 cannot be stored sortably")
+	}
+	var v OSVersion
+	if err := v.Scan([]byte("17.4")); err != nil || v.String() != "17.4.0" {
+		t.Fatalf("Text columns should scan: %s %v", v.String(), err)
+	}
+}
+
+func TestVersionGormModel(t *testing.T) {
+	type release struct {
+		ID      uint
+		Version OSVersion `gorm:"index"`
+		Build   BuildNumber
+		Full    IOSVersion
+	}
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if err := db.AutoMigrate(&release{}); err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, s := range []string{"17.0.1 (21A340, 21A341)", "9.3.5 (13G36)", "17.0.0 (21A329)", "10.0.0 (14A346)"} {
+		var full IOSVersion
+		full.UnmarshalText([]byte(s))
+		if err := db.Create(&release{Version: full.Version, Build: full.Builds[0], Full: full}).Error; err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	var releases []release
+	min, _ := OSVersionFromString("10")
+	if err := db.Where("version >= ?", min).Order("version").Find(&releases).Error; err != nil {
+		t.Fatalf(err.Error())
+	}
+	if len(releases) != 3 || releases[0].Version.String() != "10.0.0" || releases[2].Full.String() != "17.0.1 (21A340, 21A341)" || releases[2].Build.String() != "21A340" {
+		t.Fatalf("Unexpected releases: %+v", releases)
+	}
+}
+
+func TestParseOSVersionStrict(t *testing.T) {
+	for s, expected := range map[string]string{"17": "17.0.0", "17.4": "17.4.0", "17.4.1": "17.4.1", "0.0.0": "0.0.0", "10.30.100": "10.30.100", "1": "1.0.0", "1.2": "1.2.0"} {
+		v, err := ParseOSVersion(s)
+		if err != nil || v.String() != expected {
+			t.Fatalf("%s: expected %s, got %s %v", s, expected, v.String(), err)
+		}
+	}
+	for s, expected := range map[string]string{
+		"":                         "empty version",
+		"1.3,4":                    `unexpected ',' at offset 3`,
+		"1.2.3.4":                  "has 4 components, at most 3",
+		"17.":                      "component 2 is empty",
+		".1":                       "component 1 is empty",
+		"17.04":                    "component 2 has a leading zero",
+		" 17.4":                    `unexpected ' ' at offset 0`,
+		"17.4.1 (a)":               `unexpected ' ' at offset 6`,
+		"+17":                      `unexpected '+' at offset 0`,
+		"99999999999999999999.0.0": "component 1 is out of range",
+	} {
+		_, err := ParseOSVersion(s)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("%q: expected an error about %q, got %v", s, expected, err)
+		}
+	}
+}
+
+func TestExtractOSVersion(t *testing.T) {
+	for text, expected := range map[string]LenientVersion{
+		"17.0.1":               {Version: OSVersion{X: 17, Y: 0, Z: 1}},
+		"  17.0.1 (a)":         {Version: OSVersion{X: 17, Y: 0, Z: 1}, Suffix: "(a)", Annotations: []string{"a"}},
+		"16.4[12]":             {Version: OSVersion{X: 16, Y: 4}, Suffix: "[12]", Annotations: []string{"12"}},
+		"15.7.9 ( b )[note 3]": {Version: OSVersion{X: 15, Y: 7, Z: 9}, Suffix: "( b )[note 3]", Annotations: []string{"b", "note 3"}},
+		"1.3,4":                {Version: OSVersion{X: 1, Y: 3}, Suffix: ",4"},
+		"12.05 beta":           {Version: OSVersion{X: 12, Y: 5}, Suffix: "beta"},
+		"17.0.1a":              {Version: OSVersion{X: 17, Y: 0, Z: 1}, Suffix: "a"},
+	} {
+		got, err := ExtractOSVersion(text)
+		if err != nil {
+			t.Fatalf("%q: %s", text, err.Error())
+		}
+		if !got.Version.Eq(expected.Version) || got.Suffix != expected.Suffix || strings.Join(got.Annotations, "|") != strings.Join(expected.Annotations, "|") {
+			t.Fatalf("%q: expected %+v, got %+v", text, expected, got)
+		}
+	}
+	for _, text := range []string{"", "iOS 17", "1.2.3.4", "17.", "(a) 17.0"} {
+		if _, err := ExtractOSVersion(text); err == nil {
+			t.Fatalf("%q should not yield a version", text)
+		}
+	}
+}
+
+// zeroPadded returns the version text s with the leading zeros of its
+// components removed and padded to 3 components, e.g. "17.04" -> "17.4.0".
+func zeroPadded(s string) string {
+	components := strings.Split(s, ".")
+	for i, c := range components {
+		if trimmed := strings.TrimLeft(c, "0"); trimmed != "" {
+			components[i] = trimmed
+		} else {
+			components[i] = "0"
+		}
+	}
+	for len(components) < 3 {
+		components = append(components, "0")
+	}
+	return strings.Join(components, ".")
+}
+
+func FuzzParseOSVersion(f *testing.F) {
+	for _, seed := range []string{"17", "17.4.1", "1.3,4", "1.2.3.4", "17.04", "", "0.0.0", "17.0.1 (a)"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		v, err := ParseOSVersion(s)
+		if err != nil {
+			return
+		}
+		// accepted input is canonical: it prints back, padded to 3 components
+		if v.String() != zeroPadded(s) {
+			t.Fatalf("%q was accepted but prints as %s", s, v.String())
+		}
+		back, err := ParseOSVersion(v.String())
+		if err != nil || !back.Eq(v) {
+			t.Fatalf("%s does not parse back: %v", v.String(), err)
+		}
+		lenient, err := ExtractOSVersion(s)
+		if err != nil || !lenient.Version.Eq(v) || lenient.Suffix != "" {
+			t.Fatalf("%q: the lenient extractor disagrees: %+v %v", s, lenient, err)
+		}
+	})
+}
+
+func FuzzExtractOSVersion(f *testing.F) {
+	for _, seed := range []string{"17.0.1 (a)", "16.4[12]", " 15", "1.2.3.4", "17.", "x", "15.7.9 ( b )[note 3]"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		got, err := ExtractOSVersion(text)
+		if err != nil {
+			return
+		}
+		if !strings.HasSuffix(strings.TrimSpace(text), got.Suffix) {
+			t.Fatalf("%q: suffix %q is not the end of the input", text, got.Suffix)
+		}
+		// without its suffix, the input is the version, up to leading zeros
+		// and padding
+		head := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), got.Suffix))
+		if got.Version.String() != zeroPadded(head) {
+			t.Fatalf("%q: extracted %s from %q", text, got.Version.String(), head)
+		}
+		back, err := ParseOSVersion(got.Version.String())
+		if err != nil || !back.Eq(got.Version) {
+			t.Fatalf("%q: %s does not parse back: %v", text, got.Version.String(), err)
+		}
+		for _, a := range got.Annotations {
+			if !strings.Contains(got.Suffix, a) {
+				t.Fatalf("%q: annotation %q is not part of the suffix %q", text, a, got.Suffix)
+			}
+		}
+	})
+}
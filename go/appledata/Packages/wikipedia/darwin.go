@@ -0,0 +1,94 @@
+package wikipedia
+
+import (
+	"appledata/Packages/version"
+	_ "embed"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed darwin_overrides.yaml
+var defaultDarwinOverrides []byte
+
+// DarwinOverride sets the Darwin version of every iOS release in IOS.
+type DarwinOverride struct {
+	IOS    version.OSVersionSet
+	Darwin version.OSVersion
+}
+
+type darwinOverrideYAML struct {
+	IOS    string `yaml:"ios"`
+	Darwin string `yaml:"darwin"`
+}
+
+// ParseDarwinOverrides parses a list of {ios: <version set>, darwin:
+// <version>} entries, as found in darwin_overrides.yaml.
+func ParseDarwinOverrides(data []byte) ([]DarwinOverride, error) {
+	var entries []darwinOverrideYAML
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	overrides := make([]DarwinOverride, 0, len(entries))
+	for i, entry := range entries {
+		set, err := version.ParseOSVersionSet(entry.IOS)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: ios: %w", i+1, err)
+		}
+		darwin, err := version.ParseOSVersion(entry.Darwin)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: darwin: %w", i+1, err)
+		}
+		overrides = append(overrides, DarwinOverride{IOS: set, Darwin: darwin})
+	}
+	return overrides, nil
+}
+
+// LoadDarwinOverrides reads the overrides file at path, the embedded
+// darwin_overrides.yaml when path is empty.
+func LoadDarwinOverrides(path string) ([]DarwinOverride, error) {
+	data := defaultDarwinOverrides
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	overrides, err := ParseDarwinOverrides(data)
+	if err != nil && path != "" {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return overrides, err
+}
+
+// ApplyDarwinVersions sets the Darwin version of every release: the first
+// matching override wins, then the version scraped along with the release,
+// then the one derived by version.IOSToDarwin, which is approximate.
+// Releases matching none of them are left without Darwin version.
+func ApplyDarwinVersions(versions []version.IOSVersion, overrides []DarwinOverride) {
+	for i := range versions {
+		v := &versions[i]
+		overridden := false
+		for _, o := range overrides {
+			if o.IOS.Contains(v.Version) {
+				if v.Darwin != nil && !v.Darwin.Eq(o.Darwin) {
+					log.Debugf("[ApplyDarwinVersions] %s: scraped darwin %s overridden by %s", v.Version.String(), v.Darwin.String(), o.Darwin.String())
+				}
+				darwin := o.Darwin
+				v.Darwin = &darwin
+				overridden = true
+				break
+			}
+		}
+		if overridden || v.Darwin != nil {
+			continue
+		}
+		if darwin, err := version.IOSToDarwin(v.Version); err == nil {
+			v.Darwin = &darwin
+		} else {
+			log.Debugf("[ApplyDarwinVersions] %s: %s", v.Version.String(), err.Error())
+		}
+	}
+}
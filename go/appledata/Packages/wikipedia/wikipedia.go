@@ -2,10 +2,13 @@ package wikipedia
 
 import (
 	"appledata/Packages/version"
+	"bytes"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -41,6 +44,9 @@ func httpGetWithRetry(client *http.Client, url string, maxRetries int, defaultWa
         if err != nil {
             return nil, err
         }
+        if res.StatusCode == 200 {
+            return res, recordRevision(res)
+        }
         if res.StatusCode != 429 {
             return res, nil
         }
@@ -62,6 +68,46 @@ func httpGetWithRetry(client *http.Client, url string, maxRetries int, defaultWa
     return nil, fmt.Errorf("max retries exceeded for %s", url)
 }
 
+// PageRevision identifies the exact version of a wiki page that was parsed.
+type PageRevision struct {
+	URL        string
+	RevisionID int64
+}
+
+var fetchedPages = map[string]int64{}
+var revisionRegex = regexp.MustCompile(`"wgRevisionId":([0-9]+)`)
+
+// recordRevision extracts the MediaWiki revision id from a page and stores
+// it for FetchedPages. The body is buffered and handed back to res, so
+// callers can read it as usual.
+func recordRevision(res *http.Response) error {
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	var revision int64
+	if match := revisionRegex.FindSubmatch(body); match != nil {
+		revision, _ = strconv.ParseInt(string(match[1]), 10, 64)
+	} else {
+		log.Warnf("[recordRevision] no revision id found in %s", res.Request.URL.String())
+	}
+	fetchedPages[res.Request.URL.String()] = revision
+	return nil
+}
+
+// FetchedPages lists, sorted by URL, all the pages fetched so far along with
+// their revision id (0 when the page did not report one).
+func FetchedPages() []PageRevision {
+	var pages []PageRevision
+	for url, revision := range fetchedPages {
+		pages = append(pages, PageRevision{URL: url, RevisionID: revision})
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].URL < pages[j].URL })
+	return pages
+}
+
 var WikiBaseUrl = WikiBase()
 
 var IOSVersionPages []string = []string{
@@ -158,7 +204,7 @@ func ParseiOSVersionHistory(client *http.Client) []version.OSVersion {
 			if exists {
 				trimmed := strings.TrimSpace(idattr)
 				if verregex.MatchString(trimmed) {
-					version, err := version.OSVersionFromString(trimmed)
+					version, err := version.ParseOSVersion(trimmed)
 					if err == nil {
 						versions = append(versions, version)
 					} else {
@@ -201,10 +247,16 @@ func ParseSingleIOSVersionPage(page string, client *http.Client) []version.IOSVe
 			firstHeaderCellContent := table.Find("tr").First().Find("th").First().Text()
 			if strings.TrimSpace(firstHeaderCellContent) == "Version" { // this is the right table
 				buildNumberRowsLeft := 1
+				// some tables have a kernel column, e.g. "Kernel version" or "Darwin"
+				kernelColumn := headerColumn(table, "kernel", "darwin")
+				releaseDateColumn := headerColumn(table, "release date")
+				spans := map[int]*rowSpan{}
 				table.Find("tr").Each(func(rowidx int, row *goquery.Selection) {
 					if rowidx == 0 {
 						return
 					}
+					// cells by column, e.g. a kernel cell spanning the rows of several versions
+					cells := gridRow(row, spans)
 					firstcell := row.Find("th, td").First()
 					// Some table have inner header rows. They can be spotted from the colspan > 1 property
 					if firstcell.AttrOr("colspan", "1") != "1" {
@@ -219,12 +271,12 @@ func ParseSingleIOSVersionPage(page string, client *http.Client) []version.IOSVe
 					if exists {
 						version_match := verregex.FindString(dataSortValueAttr)
 						if len(version_match) > 0 {
-							verobj, err := version.OSVersionFromString(version_match)
+							extracted, err := version.ExtractOSVersion(dataSortValueAttr[strings.Index(dataSortValueAttr, version_match):])
 							if err != nil {
-								log.Errorf("[ParseSingleIOSVersionPage] page[%s] Error parsing version from 'data-sort-value' attr string %s", page, dataSortValueAttr)
+								log.Errorf("[ParseSingleIOSVersionPage] page[%s] Error parsing version from 'data-sort-value' attr string %s: %s", page, dataSortValueAttr, err.Error())
 							}else {
 								versionStringMatched = true
-								iosVersion.Version = verobj
+								iosVersion.Version = extracted.Version
 								log.Debugf("[ParseSingleIOSVersionPage] page[%s] row[%d] Parsed version from 'data-sort-value' attr string %s", page, rowidx, dataSortValueAttr)
 							}
 						}
@@ -232,16 +284,42 @@ func ParseSingleIOSVersionPage(page string, client *http.Client) []version.IOSVe
 						rawversion := supregex.ReplaceAllString(firstCellInnerHtml, "")
 						version_match := verregex.FindString(rawversion)
 						if len(version_match) > 0 {
-							verobj, err := version.OSVersionFromString(version_match)
+							// tolerate suffixes and footnotes, e.g. "17.0.1 (a)"
+							extracted, err := version.ExtractOSVersion(rawversion[strings.Index(rawversion, version_match):])
 							if err != nil {
-								log.Errorf("[ParseSingleIOSVersionPage] page[%s] Error parsing version from cell content string %s", page, rawversion)
+								log.Errorf("[ParseSingleIOSVersionPage] page[%s] Error parsing version from cell content string %s: %s", page, rawversion, err.Error())
 							}else {
 								versionStringMatched = true
-								iosVersion.Version = verobj
+								iosVersion.Version = extracted.Version
+								if len(extracted.Annotations) > 0 {
+									log.Debugf("[ParseSingleIOSVersionPage] page[%s] row[%d] version %s annotated with %s", page, rowidx, extracted.Version.String(), strings.Join(extracted.Annotations, ", "))
+								}
 								log.Debugf("[ParseSingleIOSVersionPage] page[%s] row[%d] Parsed version from cell content %s", page, rowidx, rawversion)
 							}
 						}
 					}
+					if versionStringMatched && kernelColumn > 0 && kernelColumn < len(cells) {
+						kernelCellContent, _ := cells[kernelColumn].Html()
+						rawkernel := supregex.ReplaceAllString(kernelCellContent, "")
+						if kernel_match := verregex.FindString(rawkernel); len(kernel_match) > 0 {
+							extracted, err := version.ExtractOSVersion(rawkernel[strings.Index(rawkernel, kernel_match):])
+							if err != nil {
+								log.Warnf("[ParseSingleIOSVersionPage] page[%s] row[%d] Error parsing kernel version from cell content string %s: %s", page, rowidx, rawkernel, err.Error())
+							} else {
+								iosVersion.Darwin = &extracted.Version
+							}
+						}
+					}
+					if versionStringMatched && releaseDateColumn > 0 && releaseDateColumn < len(cells) {
+						// the date of the first build, when builds have their own dates
+						dateCellContent, _ := cells[releaseDateColumn].Html()
+						released, err := parseReleaseDate(supregex.ReplaceAllString(dateCellContent, ""))
+						if err != nil {
+							log.Warnf("[ParseSingleIOSVersionPage] page[%s] row[%d] %s", page, rowidx, err.Error())
+						} else {
+							iosVersion.Released = &released
+						}
+					}
 					// fetch build numbers
 					var buildNumberCell *goquery.Selection
 					if versionStringMatched {
@@ -284,6 +362,87 @@ func ParseSingleIOSVersionPage(page string, client *http.Client) []version.IOSVe
 	log.Infof("[ParseSingleIOSVersionPage] page[%s] versions[%d]", page, len(versions))
 	return versions
 }
+
+// rowSpan is a cell spanning the next rows of its column.
+type rowSpan struct {
+	cell *goquery.Selection
+	rows int // rows left to span
+}
+
+// gridRow returns the cells of row indexed by column: a cell with a
+// colspan fills several columns, and the cells of previous rows with a
+// rowspan, carried in spans, fill theirs.
+func gridRow(row *goquery.Selection, spans map[int]*rowSpan) []*goquery.Selection {
+	var cells []*goquery.Selection
+	column := 0
+	spanned := func() {
+		for span, ok := spans[column]; ok; span, ok = spans[column] {
+			cells = append(cells, span.cell)
+			if span.rows--; span.rows == 0 {
+				delete(spans, column)
+			}
+			column++
+		}
+	}
+	row.ChildrenFiltered("th, td").Each(func(_ int, cell *goquery.Selection) {
+		spanned()
+		colspan, err := strconv.Atoi(cell.AttrOr("colspan", "1"))
+		if err != nil || colspan < 1 {
+			colspan = 1
+		}
+		rowspan, err := strconv.Atoi(cell.AttrOr("rowspan", "1"))
+		if err != nil || rowspan < 1 {
+			rowspan = 1
+		}
+		for i := 0; i < colspan; i++ {
+			cells = append(cells, cell)
+			if rowspan > 1 {
+				spans[column] = &rowSpan{cell: cell, rows: rowspan - 1}
+			}
+			column++
+		}
+	})
+	spanned()
+	return cells
+}
+
+// headerColumn returns the index of the first header cell of table whose
+// text contains one of keywords (lower case), -1 when there is none.
+func headerColumn(table *goquery.Selection, keywords ...string) int {
+	column := -1
+	table.Find("tr").First().Find("th").EachWithBreak(func(colidx int, th *goquery.Selection) bool {
+		header := strings.ToLower(th.Text())
+		for _, keyword := range keywords {
+			if strings.Contains(header, keyword) {
+				column = colidx
+				return false
+			}
+		}
+		return true
+	})
+	return column
+}
+
+var (
+	releaseDateRegex   = regexp.MustCompile(`[A-Z][a-z]+ [0-9]{1,2}, [0-9]{4}|[0-9]{1,2} [A-Z][a-z]+ [0-9]{4}|[0-9]{4}-[0-9]{2}-[0-9]{2}`)
+	releaseDateLayouts = []string{"January 2, 2006", "2 January 2006", "2006-01-02", "Jan 2, 2006", "2 Jan 2006"}
+)
+
+// parseReleaseDate reads the first date of a release date cell, e.g.
+// "September 18, 2023", "18 September 2023" or "2023-09-18".
+func parseReleaseDate(cell string) (time.Time, error) {
+	match := releaseDateRegex.FindString(cell)
+	if match == "" {
+		return time.Time{}, fmt.Errorf("no release date in %q", cell)
+	}
+	for _, layout := range releaseDateLayouts {
+		if date, err := time.Parse(layout, match); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to parse release date %q", match)
+}
+
 func ParseiOSVersionHistory2(client *http.Client) []version.IOSVersion {
 	var versions []version.IOSVersion
 	for _, pagepath := range IOSVersionPages {
@@ -296,20 +455,17 @@ func parseHardwareStrings(hardwareStringsRow *goquery.Selection, devices *[]Devi
 	headerCellText := "Hardware strings"
 	hardwareStringsRow.Find("td").Each(func(cellidx int, tcell *goquery.Selection) {
 		content, _ := tcell.Html()
-		carriageRegex, err := regexp2.Compile("iPhone[0-9]+,[0-9]+", regexp2.None)
-		if err != nil {
-			log.Fatalf("[ParseListOfIphoneModelsTable] '%s' column: regex compile error: %s", headerCellText, err.Error())
+		var found []version.HardwareIdentifier
+		for _, hw := range version.FindHardwareIdentifiers(content) {
+			if hw.Family() == version.FamilyIPhone {
+				found = append(found, hw)
+			}
 		}
-		match, err := carriageRegex.FindStringMatch(content)
-		if err != nil {
-			log.Fatalf("[ParseListOfIphoneModelsTable] '%s' column: regex match error: %s", headerCellText, err.Error())
+		if len(found) == 0 {
+			log.Fatalf("[ParseListOfIphoneModelsTable] '%s' column: no hardware identifier in: %s", headerCellText, content)
 		}
-		if match == nil {
-			log.Fatalf("[ParseListOfIphoneModelsTable] '%s' column: regex no match: %s", headerCellText, content)
-		}	
-		for match != nil {
-			(*devices)[cellidx].Codenames = append((*devices)[cellidx].Codenames, strings.TrimSpace(match.String()))
-			match, _ = carriageRegex.FindNextMatch(match)
+		for _, hw := range found {
+			(*devices)[cellidx].Codenames = append((*devices)[cellidx].Codenames, hw.String())
 		}
 		if (len((*devices)[cellidx].Codenames) > 1) {
 			log.Infof("[ParseListOfIphoneModelsTable] model[%s] multiple codenames[%s]", (*devices)[cellidx].Modelname, strings.Join((*devices)[cellidx].Codenames, ", "))
@@ -347,7 +503,7 @@ func parseOSVersionRange(initialLatestRows *goquery.Selection, devices *[]Device
 			content := td.Text()
 			match, _ := verregex.FindStringMatch(content)
 			for match != nil {
-				oslimit, err := version.OSVersionFromString(match.GroupByName("version").Capture.String())
+				oslimit, err := version.ParseOSVersion(match.GroupByName("version").Capture.String())
 				if err != nil {
 					log.Warnf("[parseOSVersionRange] '%s' Error parsing min OS version from string: %s", headerCellText, err.Error())
 					return
@@ -384,7 +540,7 @@ func parseBasicInfoSlice(basicInfoRows *goquery.Selection, devices *[]Device) {
 }
 func ParseListOfIphoneModelsTable(client *http.Client) []Device {
 	var ListOfIphoneModelsURL string = WikiPageURL("/List_of_iPhone_models")
-	res, err := client.Get(ListOfIphoneModelsURL)
+	res, err := httpGetWithRetry(client, ListOfIphoneModelsURL, 3, 60 * time.Second)
 	if err != nil {
 		log.Fatalf("[ParseListOfIphoneModelsTable] %s", err.Error())
 	}
@@ -0,0 +1,97 @@
+package wikipedia
+
+import (
+	"appledata/Packages/version"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func v(s string) version.OSVersion {
+	ver, _ := version.OSVersionFromString(s)
+	return ver
+}
+
+func TestDarwinOverrides(t *testing.T) {
+	if _, err := LoadDarwinOverrides(""); err != nil {
+		t.Fatalf("Built-in overrides: %s", err.Error())
+	}
+	overrides, err := ParseDarwinOverrides([]byte("- ios: \">=15.7 <16\"\n  darwin: 21.6.0\n"))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	scraped := v("21.7.0")
+	versions := []version.IOSVersion{
+		{Version: v("15.7.1"), Darwin: &scraped}, // override wins
+		{Version: v("15.6"), Darwin: &scraped},   // scraped wins
+		{Version: v("16.4.1")},                   // derived
+		{Version: v("3.1.3")},                    // unknown
+	}
+	ApplyDarwinVersions(versions, overrides)
+	for i, expected := range []string{"21.6.0", "21.7.0", "22.4.0", ""} {
+		got := ""
+		if versions[i].Darwin != nil {
+			got = versions[i].Darwin.String()
+		}
+		if got != expected {
+			t.Fatalf("%s: expected darwin %q, got %q", versions[i].Version.String(), expected, got)
+		}
+	}
+	for _, bad := range []string{"- ios: \">=15.x\"\n  darwin: 21.6.0\n", "- ios: \"15.7\"\n  darwin: \"\"\n"} {
+		if _, err := ParseDarwinOverrides([]byte(bad)); err == nil {
+			t.Fatalf("%q should not parse", bad)
+		}
+	}
+}
+
+const kernelTablePage = `<html><body><table class="wikitable">
+<tr><th>Version</th><th>Build</th><th>Kernel version</th><th>Release date</th></tr>
+<tr><th rowspan="2">17.4</th><td>21E219</td><td rowspan="3">23.4.0<sup>[1]</sup></td><td>March 5, 2024</td></tr>
+<tr><td>21E217</td><td>March 5, 2024</td></tr>
+<tr><th>17.4.1</th><td>21E236</td><td>March 21, 2024</td></tr>
+<tr><th>17.5</th><td>21F79</td><td>Darwin 23.5.0</td><td>May 13, 2024</td></tr>
+</table></body></html>`
+
+func TestKernelColumn(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, kernelTablePage)
+	}))
+	defer server.Close()
+	versions := ParseSingleIOSVersionPage(server.URL, server.Client())
+	if len(versions) != 3 {
+		t.Fatalf("Expected 3 versions, got %v", versions)
+	}
+	// 17.4.1 follows a kernel cell spanning its row
+	for i, expected := range []string{"23.4.0", "23.4.0", "23.5.0"} {
+		if rel := versions[i]; rel.Darwin == nil || rel.Darwin.String() != expected {
+			t.Fatalf("%s: expected darwin %s, got %v", rel.Version.String(), expected, rel.Darwin)
+		}
+	}
+	if len(versions[0].Builds) != 2 {
+		t.Fatalf("Expected 2 builds of 17.4, got %v", versions[0].Builds)
+	}
+	for i, expected := range []string{"2024-03-05", "2024-03-21", "2024-05-13"} {
+		if released := versions[i].Released; released == nil || released.Format(version.ReleaseDateLayout) != expected {
+			t.Fatalf("%s: expected release date %s, got %v", versions[i].Version.String(), expected, released)
+		}
+	}
+}
+
+func TestParseReleaseDate(t *testing.T) {
+	for cell, expected := range map[string]string{
+		"September 18, 2023":            "2023-09-18",
+		"18 September 2023[12]":         "2023-09-18",
+		"2023-09-18":                    "2023-09-18",
+		"Sep 18, 2023 (US only)":        "2023-09-18",
+		"March 5, 2024 / March 7, 2024": "2024-03-05",
+	} {
+		date, err := parseReleaseDate(cell)
+		if err != nil || date.Format(version.ReleaseDateLayout) != expected {
+			t.Fatalf("%q: expected %s, got %v %v", cell, expected, date, err)
+		}
+	}
+	if _, err := parseReleaseDate("Unreleased"); err == nil {
+		t.Fatalf("A cell without a date should not parse")
+	}
+}
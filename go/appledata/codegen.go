@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"appledata/Packages/codegen"
+	"appledata/Packages/dataset"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type goPackageOptions struct {
+	pkg    *string
+	module *string
+}
+
+func goPackageFlags(flags *flag.FlagSet) goPackageOptions {
+	return goPackageOptions{
+		pkg:    flags.String("go-package", "appledevices", "name of the generated Go package"),
+		module: flags.String("go-module", "", "if set, also write a go.mod declaring this module path"),
+	}
+}
+
+func writeGoPackage(dir string, opts goPackageOptions, catalog codegen.Catalog) {
+	if err := codegen.WriteGoPackage(dir, *opts.pkg, *opts.module, catalog); err != nil {
+		log.Fatalf("Unable to write Go package to %s: %s", dir, err.Error())
+	}
+	log.Infof("Go package %s written to %s", *opts.pkg, dir)
+}
+
+func genGo(args []string) {
+	flags := flag.NewFlagSet("gen-go", flag.ExitOnError)
+	dbfile := flags.String("db", defaultDBPath(), "path of the db file")
+	out := flags.String("o", "appledevices", "output directory")
+	opts := goPackageFlags(flags)
+	flags.Parse(args)
+
+	writeGoPackage(*out, opts, loadCatalog(*dbfile))
+}
+
+func loadCatalog(dbfile string) codegen.Catalog {
+	ds, err := dataset.LoadFile(dbfile)
+	if err != nil {
+		log.Fatalf("Unable to load %s: %s", dbfile, err.Error())
+	}
+	return codegen.CatalogFromDataset(ds)
+}
+
+func writeSource(filename string, src []byte) {
+	if err := os.WriteFile(filename, src, 0644); err != nil {
+		log.Fatalf("Unable to write %s: %s", filename, err.Error())
+	}
+	log.Infof("Source written to %s", filename)
+}
+
+func readTemplate(filename string) string {
+	tmpl, err := codegen.ReadTemplate(filename)
+	if err != nil {
+		log.Fatalf("Unable to read template %s: %s", filename, err.Error())
+	}
+	return tmpl
+}
+
+func genSwift(args []string) {
+	flags := flag.NewFlagSet("gen-swift", flag.ExitOnError)
+	dbfile := flags.String("db", defaultDBPath(), "path of the db file")
+	out := flags.String("o", "AppleDeviceCatalog.swift", "output file")
+	tmplFile := flags.String("template", "", "text/template file to use instead of the built-in one")
+	flags.Parse(args)
+
+	src, err := codegen.Swift(loadCatalog(*dbfile), readTemplate(*tmplFile))
+	if err != nil {
+		log.Fatalf("Unable to render Swift catalog: %s", err.Error())
+	}
+	writeSource(*out, src)
+}
+
+func genKotlin(args []string) {
+	flags := flag.NewFlagSet("gen-kotlin", flag.ExitOnError)
+	dbfile := flags.String("db", defaultDBPath(), "path of the db file")
+	out := flags.String("o", "AppleDeviceCatalog.kt", "output file")
+	pkg := flags.String("kotlin-package", "com.example.appledata", "package of the generated Kotlin file")
+	tmplFile := flags.String("template", "", "text/template file to use instead of the built-in one")
+	flags.Parse(args)
+
+	src, err := codegen.Kotlin(*pkg, loadCatalog(*dbfile), readTemplate(*tmplFile))
+	if err != nil {
+		log.Fatalf("Unable to render Kotlin catalog: %s", err.Error())
+	}
+	writeSource(*out, src)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"appledata/Packages/compat"
+	"appledata/Packages/dataset"
+	"appledata/Packages/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func compatQuery(args []string) {
+	flags := flag.NewFlagSet("compat", flag.ExitOnError)
+	dbfile := flags.String("db", defaultDBPath(), "path of the db file")
+	family := flags.String("family", "ios", "OS family")
+	excludes := flags.String("not", "", "only keep the devices running none of these versions, e.g. 18.0")
+	deviceFamily := flags.String("device-family", "", "only list devices of this family, e.g. iPhone or iPad")
+	format := flags.String("format", compat.FormatTable, "output format: "+strings.Join(compat.Formats, ", "))
+	flags.Usage = func() {
+		flags.Output().Write([]byte("usage: appledata compat [flags] <versions>\n" +
+			"lists the devices running a release in <versions>, and the ones that were dropped before,\n" +
+			"e.g. '17.2', '>=16 <17', '[15.0,16.0) || >=17.4'\n"))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	q, err := compat.ParseQuery(*family, flags.Arg(0), *excludes)
+	if err != nil {
+		log.Fatalf("Invalid query: %s", err.Error())
+	}
+	q.DeviceFamily = version.DeviceFamily(*deviceFamily)
+	ds, err := dataset.LoadFile(*dbfile)
+	if err != nil {
+		log.Fatalf("Unable to load %s: %s", *dbfile, err.Error())
+	}
+	report := compat.Run(ds, q)
+	if len(report.Releases) == 0 {
+		log.Warnf("No %s release of %s matches %s", *family, *dbfile, report.Supports)
+	}
+	if err := compat.Write(os.Stdout, report, *format); err != nil {
+		log.Fatalf("Unable to write report: %s", err.Error())
+	}
+}
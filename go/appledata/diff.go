@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"appledata/Packages/diff"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func diffDBs(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := flags.String("format", diff.FormatText, "output format: "+strings.Join(diff.Formats, ", "))
+	exitCode := flags.Bool("exit-code", false, "exit with status 1 when the dbs differ")
+	flags.Usage = func() {
+		flags.Output().Write([]byte("usage: appledata diff [flags] <old db> <new db>\n" +
+			"lists the processors, OS versions, builds, devices and device/OS associations added, removed\n" +
+			"or modified between two db files\n"))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	report, err := diff.Files(flags.Arg(0), flags.Arg(1))
+	if err != nil {
+		log.Fatalf("Unable to compare: %s", err.Error())
+	}
+	if err := diff.Write(os.Stdout, report, *format); err != nil {
+		log.Fatalf("Unable to write report: %s", err.Error())
+	}
+	if *exitCode && !report.Empty() {
+		os.Exit(1)
+	}
+}
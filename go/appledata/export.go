@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"appledata/Packages/dataset"
+	"appledata/Packages/dbtools"
+	"appledata/Packages/export"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func exportDB(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	dbfile := flags.String("db", defaultDBPath(), "path of the db file to export")
+	format := flags.String("format", export.FormatJSON, "output format: "+strings.Join(export.Formats, ", "))
+	views := flags.Bool("views", false, "export the v_os_model and v_os_build views instead of the tables (flat formats only)")
+	output := flags.String("o", "", "output file (default stdout); for csv, the output directory (default build/export)")
+	flags.Parse(args)
+
+	db, err := dbtools.OpenReadOnly(*dbfile)
+	if err != nil {
+		log.Fatalf("Unable to open %s: %s", *dbfile, err.Error())
+	}
+	ds, err := dataset.Load(db)
+	if err != nil {
+		log.Fatalf("Unable to load %s: %s", *dbfile, err.Error())
+	}
+	tables := export.Tables(ds)
+	if *views {
+		if *format == export.FormatJSON || *format == export.FormatYAML {
+			log.Fatalf("-views requires a flat format (%s, %s or %s)", export.FormatJSONFlat, export.FormatYAMLFlat, export.FormatCSV)
+		}
+		tables, err = export.ViewTables(db)
+		if err != nil {
+			log.Fatalf("Unable to read views from %s: %s", *dbfile, err.Error())
+		}
+	}
+
+	if *format == export.FormatCSV {
+		dir := *output
+		if dir == "" {
+			dir = path.Join(buildDir(), "export")
+		}
+		if err := export.WriteCSV(dir, tables); err != nil {
+			log.Fatalf("Unable to write CSV files to %s: %s", dir, err.Error())
+		}
+		log.Infof("CSV files written to %s", dir)
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Unable to create %s: %s", *output, err.Error())
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case export.FormatJSON:
+		err = export.WriteJSON(w, ds)
+	case export.FormatJSONFlat:
+		err = export.WriteFlatJSON(w, tables)
+	case export.FormatYAML:
+		err = export.WriteYAML(w, ds)
+	case export.FormatYAMLFlat:
+		err = export.WriteFlatYAML(w, tables)
+	default:
+		log.Fatalf("Unknown format %s, expected one of: %s", *format, strings.Join(export.Formats, ", "))
+	}
+	if err != nil {
+		log.Fatalf("Unable to export %s: %s", *dbfile, err.Error())
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"appledata/Packages/compat"
+	"appledata/Packages/dataset"
+	"appledata/Packages/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func impactQuery(args []string) {
+	flags := flag.NewFlagSet("impact", flag.ExitOnError)
+	dbfile := flags.String("db", defaultDBPath(), "path of the db file")
+	family := flags.String("family", "ios", "OS family")
+	weightsFile := flags.String("weights", "", "CSV of device shares from analytics: a hardware string or model name and a weight per row")
+	deviceFamily := flags.String("device-family", "", "only consider devices of this family, e.g. iPhone or iPad")
+	format := flags.String("format", compat.FormatTable, "output format: "+strings.Join(compat.Formats, ", "))
+	flags.Usage = func() {
+		flags.Output().Write([]byte("usage: appledata impact [flags] <deployment target>\n" +
+			"lists the devices excluded by raising the minimum OS version to <deployment target>, e.g. 17.0,\n" +
+			"and with -weights the percentage of users on them\n"))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	target, err := version.ParseOSVersion(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Invalid deployment target: %s", err.Error())
+	}
+	var weights compat.Weights
+	if *weightsFile != "" {
+		f, err := os.Open(*weightsFile)
+		if err != nil {
+			log.Fatalf("Unable to open %s: %s", *weightsFile, err.Error())
+		}
+		weights, err = compat.ReadWeights(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Unable to read weights from %s: %s", *weightsFile, err.Error())
+		}
+	}
+	ds, err := dataset.LoadFile(*dbfile)
+	if err != nil {
+		log.Fatalf("Unable to load %s: %s", *dbfile, err.Error())
+	}
+	impact := compat.Assess(ds, *family, target, version.DeviceFamily(*deviceFamily), weights)
+	if len(impact.Unmatched) > 0 {
+		log.Warnf("%d weights match no device of %s: %s", len(impact.Unmatched), *dbfile, strings.Join(impact.Unmatched, ", "))
+	}
+	if err := compat.WriteImpact(os.Stdout, impact, *format); err != nil {
+		log.Fatalf("Unable to write impact: %s", err.Error())
+	}
+}
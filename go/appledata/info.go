@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"appledata/Packages/dbtools"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func printMetadata(meta dbtools.BuildMetadata) {
+	fmt.Println(meta.String())
+	fmt.Printf("  sources: %s\n", meta.Sources)
+	fmt.Println("  pages:")
+	for _, page := range meta.PageRevisions {
+		fmt.Printf("    %s (revision %d)\n", page.URL, page.RevisionID)
+	}
+	fmt.Println("  rows:")
+	for _, count := range meta.RowCounts {
+		fmt.Printf("    %-20s %d\n", count.Name, count.RowCount)
+	}
+}
+
+func info(args []string) {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	dbfile := flags.String("db", defaultDBPath(), "path of the db file")
+	all := flags.Bool("all", false, "show every recorded run instead of the latest one")
+	asJSON := flags.Bool("json", false, "print the metadata as JSON")
+	flags.Parse(args)
+
+	runs, err := dbtools.ReadMetadata(*dbfile)
+	if err != nil {
+		log.Fatalf("Unable to read metadata from %s: %s", *dbfile, err.Error())
+	}
+	if len(runs) == 0 {
+		log.Fatalf("No build metadata found in %s", *dbfile)
+	}
+	if !*all {
+		runs = runs[:1]
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(runs); err != nil {
+			log.Fatalf("Unable to encode metadata: %s", err.Error())
+		}
+		return
+	}
+	for _, run := range runs {
+		printMetadata(run)
+	}
+}
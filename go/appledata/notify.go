@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+
+	"appledata/Packages/notify"
+)
+
+// notifierFlag collects the notifiers of repeated -notify flags.
+type notifierFlag struct {
+	specs     []string
+	notifiers []notify.Notifier
+}
+
+func (f *notifierFlag) String() string {
+	return strings.Join(f.specs, " ")
+}
+
+func (f *notifierFlag) Set(spec string) error {
+	n, err := notify.Parse(spec)
+	if err != nil {
+		return err
+	}
+	f.specs = append(f.specs, spec)
+	f.notifiers = append(f.notifiers, n)
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"appledata/Packages/dataset"
+	"appledata/Packages/render"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func renderTemplate(args []string) {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	dbfile := flags.String("db", defaultDBPath(), "path of the db file")
+	tmplFile := flags.String("template", "", "text/template file to render (required)")
+	output := flags.String("o", "", "output file (default stdout)")
+	flags.Parse(args)
+
+	if *tmplFile == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	text, err := os.ReadFile(*tmplFile)
+	if err != nil {
+		log.Fatalf("Unable to read template %s: %s", *tmplFile, err.Error())
+	}
+	ds, err := dataset.LoadFile(*dbfile)
+	if err != nil {
+		log.Fatalf("Unable to load %s: %s", *dbfile, err.Error())
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Unable to create %s: %s", *output, err.Error())
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := render.Render(w, *tmplFile, string(text), ds); err != nil {
+		log.Fatalf("Unable to render %s: %s", *tmplFile, err.Error())
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"os"
+
+	"appledata/Packages/dataset"
+	"appledata/Packages/resolve"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func resolveInput(args []string) {
+	flags := flag.NewFlagSet("resolve", flag.ExitOnError)
+	dbfile := flags.String("db", defaultDBPath(), "path of the db file")
+	ua := flags.String("ua", "", "User-Agent to resolve")
+	machine := flags.String("machine", "", "machine identifier to resolve, e.g. iPhone15,4")
+	flags.Usage = func() {
+		flags.Output().Write([]byte("usage: appledata resolve [-db file] [-ua user-agent] [-machine hardware-string]\n" +
+			"without -ua nor -machine, every line of stdin (a User-Agent or a hardware string) is resolved as a JSON line\n"))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	ds, err := dataset.LoadFile(*dbfile)
+	if err != nil {
+		log.Fatalf("Unable to load %s: %s", *dbfile, err.Error())
+	}
+	r := resolve.New(ds)
+	enc := json.NewEncoder(os.Stdout)
+	if *ua != "" || *machine != "" {
+		res, err := r.Resolve(*ua, *machine)
+		if err != nil {
+			log.Fatalf("Unable to resolve: %s", err.Error())
+		}
+		enc.SetIndent("", "  ")
+		enc.Encode(res)
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		res, err := r.ResolveLine(scanner.Text())
+		if err != nil {
+			log.Warnf("[resolve] %q: %s", scanner.Text(), err.Error())
+		}
+		enc.Encode(res)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("Unable to read stdin: %s", err.Error())
+	}
+}
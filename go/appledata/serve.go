@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"appledata/Packages/api"
+	"appledata/Packages/dataset"
+	"appledata/Packages/dbtools"
+	"appledata/Packages/gql"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func serveAPI(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	dbfile := flags.String("db", defaultDBPath(), "path of the db file")
+	addr := flags.String("addr", ":8080", "address to listen on")
+	flags.Parse(args)
+
+	ds, err := dataset.LoadFile(*dbfile)
+	if err != nil {
+		log.Fatalf("Unable to load %s: %s", *dbfile, err.Error())
+	}
+	meta, err := dbtools.ReadMetadata(*dbfile)
+	if err != nil {
+		log.Fatalf("Unable to read build metadata of %s: %s", *dbfile, err.Error())
+	}
+	schema, err := gql.Schema(ds)
+	if err != nil {
+		log.Fatalf("Unable to build the GraphQL schema: %s", err.Error())
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/graphql", gql.Handler(schema))
+	mux.Handle("/", api.New(ds, meta))
+	log.Infof("[serve] serving %s on %s, spec at /openapi.yaml, GraphQL at /graphql", *dbfile, *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatalf("Unable to serve: %s", err.Error())
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"appledata/Packages/output"
+	"appledata/Packages/query"
+	"appledata/Packages/version"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// timelineRow is the printed form of a query.Timeline; unknown dates,
+// spans and drops are left empty.
+type timelineRow struct {
+	HardwareString string   `json:"hardware_string"`
+	ModelName      string   `json:"model_name"`
+	Family         string   `json:"family"`
+	ShippingOS     string   `json:"shipping_os"`
+	ShippingDate   string   `json:"shipping_date,omitempty"`
+	LastMajor      int      `json:"last_major"`
+	LastUpdate     string   `json:"last_update"`
+	LastUpdateDate string   `json:"last_update_date,omitempty"`
+	SupportYears   *float64 `json:"support_years,omitempty"`
+	DroppedBy      *int     `json:"dropped_by,omitempty"`
+}
+
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(version.ReleaseDateLayout)
+}
+
+func toTimelineRow(t query.Timeline) timelineRow {
+	return timelineRow{
+		HardwareString: t.Device.HardwareString,
+		ModelName:      t.Device.ModelName,
+		Family:         t.Family,
+		ShippingOS:     t.ShippingOS.String(),
+		ShippingDate:   formatDate(t.ShippingDate),
+		LastMajor:      t.LastMajor,
+		LastUpdate:     t.LastUpdate.String(),
+		LastUpdateDate: formatDate(t.LastUpdateDate),
+		SupportYears:   t.SupportYears,
+		DroppedBy:      t.DroppedBy,
+	}
+}
+
+func (r timelineRow) supportYears() string {
+	if r.SupportYears == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*r.SupportYears, 'f', 2, 64)
+}
+
+func (r timelineRow) droppedBy() string {
+	if r.DroppedBy == nil {
+		return ""
+	}
+	return strconv.Itoa(*r.DroppedBy)
+}
+
+func writeTimelines(w io.Writer, rows []timelineRow, format string) error {
+	return output.Writers{
+		output.FormatTable: func(w io.Writer) error {
+			var cells [][]string
+			for _, r := range rows {
+				cells = append(cells, []string{r.HardwareString, r.ModelName, r.ShippingOS, r.ShippingDate, strconv.Itoa(r.LastMajor), r.LastUpdate, r.LastUpdateDate, r.supportYears(), r.droppedBy()})
+			}
+			return output.Table(w, []string{"HARDWARE", "MODEL", "SHIPPED WITH", "SHIPPED ON", "LAST MAJOR", "LAST UPDATE", "UPDATED ON", "YEARS", "DROPPED BY"}, cells)
+		},
+		output.FormatJSON: func(w io.Writer) error { return output.JSON(w, rows) },
+		output.FormatCSV: func(w io.Writer) error {
+			var cells [][]string
+			for _, r := range rows {
+				cells = append(cells, []string{r.HardwareString, r.ModelName, r.Family, r.ShippingOS, r.ShippingDate, strconv.Itoa(r.LastMajor), r.LastUpdate, r.LastUpdateDate, r.supportYears(), r.droppedBy()})
+			}
+			return output.CSV(w, []string{"hardware_string", "model_name", "family", "shipping_os", "shipping_date", "last_major", "last_update", "last_update_date", "support_years", "dropped_by"}, cells)
+		},
+	}.Write(w, format)
+}
+
+func timelineQuery(args []string) {
+	flags := flag.NewFlagSet("timeline", flag.ExitOnError)
+	dbfile := flags.String("db", defaultDBPath(), "path of the db file")
+	family := flags.String("family", "ios", "OS family")
+	device := flags.String("device", "", "only print the timeline of this hardware string, e.g. iPhone10,3")
+	droppedBy := flags.Int("dropped-by", 0, "only print the devices dropped by this major version, e.g. 17")
+	format := flags.String("format", output.FormatTable, "output format: "+strings.Join(output.Formats, ", "))
+	flags.Usage = func() {
+		flags.Output().Write([]byte("usage: appledata timeline [flags]\n" +
+			"prints, for each device, the release it shipped with, its last major version and update,\n" +
+			"its years of support and the major version that dropped it\n"))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	q, err := query.Open(*dbfile)
+	if err != nil {
+		log.Fatalf("Unable to open %s: %s", *dbfile, err.Error())
+	}
+	defer q.Close()
+	var timelines []query.Timeline
+	if *device != "" {
+		t, err := q.TimelineFor(*family, *device)
+		if err != nil {
+			log.Fatalf("Unable to query timelines: %s", err.Error())
+		}
+		timelines = append(timelines, t)
+	} else if timelines, err = q.Timelines(*family); err != nil {
+		log.Fatalf("Unable to query timelines: %s", err.Error())
+	}
+	rows := []timelineRow{}
+	for _, t := range timelines {
+		if *droppedBy != 0 && (t.DroppedBy == nil || *t.DroppedBy != *droppedBy) {
+			continue
+		}
+		rows = append(rows, toTimelineRow(t))
+	}
+	if err := writeTimelines(os.Stdout, rows, *format); err != nil {
+		log.Fatalf("Unable to write timelines: %s", err.Error())
+	}
+}